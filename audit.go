@@ -0,0 +1,80 @@
+package gormup
+
+import (
+	"context"
+	"encoding/json"
+
+	"gorm.io/gorm"
+)
+
+type AuditAction string
+
+const (
+	AuditCreate AuditAction = "create"
+	AuditUpdate AuditAction = "update"
+	AuditDelete AuditAction = "delete"
+)
+
+type AuditRecord struct {
+	Action  AuditAction
+	Table   string
+	Key     string
+	Actor   string
+	Changes []Change
+}
+
+type Audit interface {
+	Record(tx *gorm.DB, rec AuditRecord) error
+}
+
+type actorKey struct{}
+
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+type auditTable struct {
+	table string
+}
+
+func NewAuditTable(table string) Audit {
+	return &auditTable{
+		table: table,
+	}
+}
+
+func (a *auditTable) Record(tx *gorm.DB, rec AuditRecord) error {
+	changes, err := json.Marshal(rec.Changes)
+	if err != nil {
+		return err
+	}
+	return tx.Session(&gorm.Session{NewDB: true}).
+		Table(a.table).
+		Create(map[string]any{
+			"table_name": rec.Table,
+			"entity_key": rec.Key,
+			"action":     string(rec.Action),
+			"actor":      rec.Actor,
+			"changes":    string(changes),
+			"created_at": tx.NowFunc(),
+		}).
+		Error
+}
+
+func (p *plugin) audit(db *gorm.DB, action AuditAction, cs *changeSet) {
+	if p.config.Audit == nil || cs == nil {
+		return
+	}
+	_ = db.AddError(p.config.Audit.Record(db, AuditRecord{
+		Action:  action,
+		Table:   cs.table,
+		Key:     cs.key,
+		Actor:   ActorFromContext(db.Statement.Context),
+		Changes: actualChanges(cs.changes),
+	}))
+}
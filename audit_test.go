@@ -0,0 +1,229 @@
+package gormup
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type recordingAudit struct {
+	sync.Mutex
+	records []AuditRecord
+}
+
+func (a *recordingAudit) Record(tx *gorm.DB, rec AuditRecord) error {
+	a.Lock()
+	defer a.Unlock()
+	a.records = append(a.records, rec)
+	return nil
+}
+
+func (a *recordingAudit) take() []AuditRecord {
+	a.Lock()
+	defer a.Unlock()
+	records := a.records
+	a.records = nil
+	return records
+}
+
+func TestAuditUntrackedUpdates(t *testing.T) {
+	cases := []struct {
+		name   string
+		cfg    Config
+		noRows bool
+		update func(db *gorm.DB) *gorm.DB
+		keys   []string
+	}{
+		{
+			name: "bulk",
+			update: func(db *gorm.DB) *gorm.DB {
+				return db.Model(&testDoc{}).Where("number = ?", 1).Update("name", "x")
+			},
+			keys: []string{""},
+		},
+		{
+			name: "by keys",
+			update: func(db *gorm.DB) *gorm.DB {
+				return db.Model(&testDoc{}).Where("id IN ?", []int{1, 2}).Update("name", "x")
+			},
+			keys: []string{"1", "2"},
+		},
+		{
+			name: "without reduce scope",
+			update: func(db *gorm.DB) *gorm.DB {
+				return WithoutReduceUpdate(db).Save(&testDoc{ID: 3, Name: "x"})
+			},
+			keys: []string{"3"},
+		},
+		{
+			name: "without reduce config",
+			cfg:  Config{WithoutReduceUpdate: true},
+			update: func(db *gorm.DB) *gorm.DB {
+				return db.Model(&testDoc{}).Where("number = ?", 1).Update("name", "x")
+			},
+			keys: []string{""},
+		},
+		{
+			name:   "no rows",
+			noRows: true,
+			update: func(db *gorm.DB) *gorm.DB {
+				return db.Model(&testDoc{}).Where("number = ?", 1).Update("name", "x")
+			},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			audit := &recordingAudit{}
+			tt.cfg.Audit = audit
+			db, fake := openTestDB(t, tt.cfg)
+			if tt.noRows {
+				fake.affected = 0
+			}
+
+			if err := tt.update(db).Error; err != nil {
+				t.Fatal(err)
+			}
+			if n := fake.count("UPDATE"); n != 1 {
+				t.Fatalf("update count = %d; want 1", n)
+			}
+
+			records := audit.take()
+			if len(records) != len(tt.keys) {
+				t.Fatalf("records = %+v; want keys %v", records, tt.keys)
+			}
+			for i, rec := range records {
+				if rec.Action != AuditUpdate || rec.Table != "test_docs" || rec.Key != tt.keys[i] {
+					t.Errorf("record %d = %+v", i, rec)
+				}
+				var name *Change
+				for j := range rec.Changes {
+					if rec.Changes[j].Column == "name" {
+						name = &rec.Changes[j]
+					}
+				}
+				if name == nil || name.New != "x" || !name.Unknown {
+					t.Errorf("record %d name change = %+v", i, name)
+				}
+			}
+		})
+	}
+}
+
+type auditedDoc struct {
+	ID        uint64 `gorm:"primaryKey"`
+	Name      string
+	Number    int64
+	UpdatedBy string `gormup:"always"`
+	UpdatedAt time.Time
+}
+
+func TestAuditRecordsActualChanges(t *testing.T) {
+	cases := []struct {
+		name  string
+		save  func(db *gorm.DB, d *auditedDoc) error
+		write []string
+	}{
+		{
+			// number совпал со снимком и записан только из-за Select
+			name: "forced",
+			save: func(db *gorm.DB, d *auditedDoc) error {
+				return WriteSelected(db).Select("name", "number").Save(d).Error
+			},
+			write: []string{"`name`=?", "`number`=?", "`updated_at`=?"},
+		},
+		{
+			name:  "ride along",
+			save:  func(db *gorm.DB, d *auditedDoc) error { return db.Save(d).Error },
+			write: []string{"`name`=?", "`updated_by`=?", "`updated_at`=?"},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			audit := &recordingAudit{}
+			db, fake := openTestDB(t, Config{Audit: audit, Outbox: NewOutbox("outbox")})
+			d := &auditedDoc{ID: 1, Name: "a", Number: 1, UpdatedBy: "u", UpdatedAt: time.Now().Add(-time.Hour)}
+			seedEntity(t, db, d)
+
+			d.Name = "b"
+			if err := tt.save(db, d); err != nil {
+				t.Fatal(err)
+			}
+
+			var update, outbox *fakeQuery
+			q := fake.take()
+			for i := range q {
+				switch {
+				case strings.HasPrefix(q[i].SQL, "UPDATE"):
+					update = &q[i]
+				case strings.HasPrefix(q[i].SQL, "INSERT INTO `outbox`"):
+					outbox = &q[i]
+				}
+			}
+			if update == nil {
+				t.Fatal("no update")
+			}
+			for _, col := range tt.write {
+				if !strings.Contains(update.SQL, col) {
+					t.Errorf("update = %s; want %s written", update.SQL, col)
+				}
+			}
+
+			want := []Change{{Column: "name", Old: "a", New: "b"}}
+			records := audit.take()
+			if len(records) != 1 {
+				t.Fatalf("records = %+v", records)
+			}
+			if got := records[0].Changes; len(got) != 1 || got[0].Column != "name" || got[0].Old != "a" || got[0].New != "b" {
+				t.Errorf("audit changes = %+v; want %+v", got, want)
+			}
+
+			if outbox == nil {
+				t.Fatal("no outbox event")
+			}
+			changes, _ := json.Marshal(want)
+			if !slices.Contains(outbox.Args, driver.Value(string(changes))) {
+				t.Errorf("outbox args = %v; want changes %s", outbox.Args, changes)
+			}
+		})
+	}
+}
+
+func TestAuditLifecycle(t *testing.T) {
+	audit := &recordingAudit{}
+	db, _ := openTestDB(t, Config{Audit: audit})
+	db = db.WithContext(WithActor(db.Statement.Context, "alice"))
+
+	d := &testDoc{ID: 1, Name: "a", Number: 1}
+	if err := db.Create(d).Error; err != nil {
+		t.Fatal(err)
+	}
+	d.Number = 2
+	if err := db.Save(d).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete(d).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	want := []AuditRecord{
+		{Action: AuditCreate, Table: "test_docs", Key: "1", Actor: "alice", Changes: []Change{
+			{Column: "name", New: "a"}, {Column: "number", New: int64(1)},
+		}},
+		{Action: AuditUpdate, Table: "test_docs", Key: "1", Actor: "alice", Changes: []Change{
+			{Column: "number", Old: int64(1), New: int64(2), changed: true},
+		}},
+		{Action: AuditDelete, Table: "test_docs", Key: "1", Actor: "alice", Changes: []Change{
+			{Column: "name", Old: "a"}, {Column: "number", Old: int64(2)},
+		}},
+	}
+	if got := audit.take(); !reflect.DeepEqual(got, want) {
+		t.Errorf("records = %+v\nwant %+v", got, want)
+	}
+}
@@ -0,0 +1,163 @@
+package gormup
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+type Change struct {
+	Column string `json:"column"`
+	Old    any    `json:"old"`
+	New    any    `json:"new"`
+	// Unknown — старое значение неизвестно: снимка нет или колонка
+	// была записана выражением, и Old не стоит читать как прежнее значение
+	Unknown bool `json:"unknown,omitempty"`
+
+	// changed — значение отличается от известного снимка; попутные
+	// колонки и записи без снимка слушателям не передаются
+	changed bool
+	// unchanged — значение совпало со снимком и записано только потому,
+	// что колонку выбрали явно
+	unchanged bool
+	// rideAlong — колонка записана вместе с другими изменениями
+	// (updated_at, always, теги "-")
+	rideAlong bool
+}
+
+// actualChanges оставляет колонки, которые изменились или могли измениться:
+// без попутных и совпавших со снимком.
+func actualChanges(changes []Change) []Change {
+	out := make([]Change, 0, len(changes))
+	for _, c := range changes {
+		if !c.rideAlong && !c.unchanged {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+type changeSet struct {
+	schema  *schema.Schema
+	table   string
+	key     string
+	changes []Change
+}
+
+func newCreateChangeSet(ent *entity) *changeSet {
+	cs := &changeSet{schema: ent.schema, table: ent.table.name, key: ent.id}
+	for _, f := range ent.schema.Fields {
+		value, ok := ent.fields[f.DBName]
+		if !ok {
+			continue
+		}
+		cs.changes = append(cs.changes, Change{Column: f.DBName, New: maskFieldValue(f, value)})
+	}
+	return cs
+}
+
+func newDeleteChangeSet(ent *entity) *changeSet {
+	cs := &changeSet{schema: ent.schema, table: ent.table.name, key: ent.id}
+	for _, f := range ent.schema.Fields {
+		value, ok := ent.fields[f.DBName]
+		if !ok {
+			continue
+		}
+		cs.changes = append(cs.changes, Change{Column: f.DBName, Old: maskFieldValue(f, value)})
+	}
+	return cs
+}
+
+// newConditionChangeSet описывает массовое удаление без ключей:
+// в Old попадают значения из условий вида column = ?.
+func (p *plugin) newConditionChangeSet(st *gorm.Statement, table entityTable) *changeSet {
+	cs := &changeSet{schema: st.Schema, table: table.name}
+	for _, f := range st.Schema.Fields {
+		if f.DBName == "" {
+			continue
+		}
+		values, ok := p.extractColumnValuesFromConditions(f.DBName, st)
+		if !ok || len(values) != 1 {
+			continue
+		}
+		cs.changes = append(cs.changes, Change{Column: f.DBName, Old: maskFieldValue(f, values[0])})
+	}
+	return cs
+}
+
+// newUntrackedUpdateChangeSets описывает обновление без снимка: старые значения
+// неизвестны, ключи берутся из условий и модели, иначе запись одна и без ключа.
+func (p *plugin) newUntrackedUpdateChangeSets(db *gorm.DB, set clause.Set) (out []*changeSet) {
+	st := db.Statement
+	if st.Schema == nil || len(set) == 0 {
+		return nil
+	}
+	table, ids := p.getConditionIDs(db)
+	if len(ids) == 0 {
+		ids = []string{""}
+	}
+	// без редукции попутными считаем колонки, которые gorm дописал сам
+	explicit := p.getExplicitColumns(db)
+	rideAlong := map[string]bool{}
+	for _, v := range set {
+		if f := st.Schema.LookUpField(v.Column.Name); f != nil && getFieldPolicy(f).ignore && !explicit[f.DBName] {
+			rideAlong[f.DBName] = true
+		}
+	}
+	for _, id := range ids {
+		ent := &entity{table: table, schema: st.Schema, reflectValue: st.ReflectValue, id: id}
+		out = append(out, newUpdateChangeSet(st.Context, ent, set, rideAlong))
+	}
+	return out
+}
+
+func newUpdateChangeSet(ctx context.Context, ent *entity, set clause.Set, rideAlong map[string]bool) *changeSet {
+	cs := &changeSet{schema: ent.schema, table: ent.table.name, key: ent.id}
+	for _, v := range set {
+		value := v.Value
+		f := ent.schema.FieldsByDBName[v.Column.Name]
+		if f != nil {
+			value = normalizeValue(ctx, f, ent.reflectValue, value)
+		}
+		change := Change{
+			Column:    v.Column.Name,
+			New:       maskFieldValue(f, toColumnValue(value)),
+			rideAlong: rideAlong[v.Column.Name],
+		}
+		if old, ok := ent.fields[v.Column.Name]; ok && ent.IsKnown(v.Column.Name) {
+			change.Old = maskFieldValue(f, old)
+			if f != nil && isSupportForUpdate(v.Value) {
+				change.changed = !ent.comparators.Equal(f, toFieldSnapshot(f, value), old)
+				change.unchanged = !change.changed
+			}
+		} else {
+			change.Unknown = true
+		}
+		cs.changes = append(cs.changes, change)
+	}
+	return cs
+}
+
+func (p *plugin) emit(db *gorm.DB, action AuditAction, cs *changeSet) {
+	p.audit(db, action, cs)
+	p.publish(db, action, cs)
+}
+
+func (p *plugin) getChangeSet(db *gorm.DB) *changeSet {
+	v, ok := db.Get(changesKey)
+	if !ok {
+		return nil
+	}
+	cs, _ := v.(*changeSet)
+	return cs
+}
+
+func (p *plugin) setChangeSet(db *gorm.DB, cs *changeSet) {
+	db.Set(changesKey, cs)
+}
+
+func (p *plugin) deleteChangeSet(db *gorm.DB) {
+	db.Statement.Settings.Delete(changesKey)
+}
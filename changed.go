@@ -0,0 +1,124 @@
+package gormup
+
+import (
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Changed работает как tx.Statement.Changed, но сравнивает значения
+// обновления со снимком, а не с самой моделью. Нужен в BeforeSave/BeforeUpdate:
+// после Save(&doc) dest и модель совпадают, и штатный Changed всегда false.
+func Changed(tx *gorm.DB, fields ...string) bool {
+	stmt := tx.Statement
+	p, err := getPlugin(tx)
+	if err != nil || stmt.Schema == nil {
+		return stmt.Changed(fields...)
+	}
+
+	// редукция уже прошла (или запись уже была): отвечаем по колонкам из SET
+	if cs := p.getChangeSet(tx); cs != nil {
+		return hasChangedColumn(stmt.Schema, cs.changes, fields)
+	}
+	if res := p.getResult(tx); res != nil {
+		changes := make([]Change, 0, len(res.Written))
+		for _, column := range res.Written {
+			changes = append(changes, Change{Column: column})
+		}
+		return hasChangedColumn(stmt.Schema, changes, fields)
+	}
+
+	ctx := stmt.Context
+	modelValue := stmt.ReflectValue
+	switch modelValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		modelValue = modelValue.Index(stmt.CurDestIndex)
+	}
+
+	table, ok := p.keyTable(tx, stmt.Schema)
+	if !ok {
+		return stmt.Changed(fields...)
+	}
+
+	var ent *entity
+	if current := createEntity(ctx, table, stmt.Schema, nil, modelValue); current != nil {
+		ent = p.entities.Get(ctx, current.GetKey())
+	} else if ent = p.getDetachedEntity(tx); ent == nil {
+		ent = p.lookupDetachedEntity(tx)
+	}
+	if ent == nil {
+		return stmt.Changed(fields...)
+	}
+
+	destValue := reflect.ValueOf(stmt.Dest)
+	for destValue.Kind() == reflect.Ptr {
+		destValue = destValue.Elem()
+	}
+	if destValue.Kind() == reflect.Slice || destValue.Kind() == reflect.Array {
+		destValue = modelValue
+	}
+	dest := &entity{schema: stmt.Schema, reflectValue: destValue}
+
+	selectColumns, restricted := stmt.SelectAndOmitColumns(false, true)
+	changed := func(f *schema.Field) bool {
+		selected, ok := selectColumns[f.DBName]
+		if !isTrackedField(f) || (ok && !selected) || (!ok && restricted) {
+			return false
+		}
+
+		var value any
+		if mv, ok := stmt.Dest.(map[string]any); ok {
+			v, ok := mv[f.Name]
+			if !ok {
+				if v, ok = mv[f.DBName]; !ok {
+					return false
+				}
+			}
+			value = toFieldSnapshot(f, normalizeValue(ctx, f, modelValue, v))
+		} else {
+			if _, zero := f.ValueOf(ctx, destValue); zero && !selected {
+				return false
+			}
+			value = dest.fieldValue(ctx, f)
+		}
+
+		if !ent.IsKnown(f.DBName) {
+			return true
+		}
+		return !p.config.Comparators.Equal(f, value, ent.fields[f.DBName])
+	}
+
+	if len(fields) == 0 {
+		for _, f := range stmt.Schema.Fields {
+			if changed(f) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, name := range fields {
+		if f := stmt.Schema.LookUpField(name); f != nil && changed(f) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasChangedColumn(sch *schema.Schema, changes []Change, fields []string) bool {
+	if len(fields) == 0 {
+		return len(changes) > 0
+	}
+	for _, name := range fields {
+		f := sch.LookUpField(name)
+		if f == nil {
+			continue
+		}
+		for _, c := range changes {
+			if c.Column == f.DBName {
+				return true
+			}
+		}
+	}
+	return false
+}
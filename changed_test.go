@@ -0,0 +1,74 @@
+package gormup
+
+import (
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+type hookedDoc struct {
+	ID     uint64 `gorm:"primaryKey"`
+	Name   string
+	Number int64
+
+	changed map[string]bool
+}
+
+func (d *hookedDoc) BeforeUpdate(tx *gorm.DB) error {
+	d.changed = map[string]bool{
+		"Name":   Changed(tx, "Name"),
+		"Number": Changed(tx, "number"),
+		"any":    Changed(tx),
+	}
+	return nil
+}
+
+func TestChangedInHooks(t *testing.T) {
+	cases := []struct {
+		name   string
+		update func(db *gorm.DB, d *hookedDoc) error
+		want   map[string]bool
+	}{
+		{
+			name: "save",
+			update: func(db *gorm.DB, d *hookedDoc) error {
+				d.Name = "b"
+				return db.Save(d).Error
+			},
+			want: map[string]bool{"Name": true, "Number": false, "any": true},
+		},
+		{
+			name: "map",
+			update: func(db *gorm.DB, d *hookedDoc) error {
+				return db.Model(d).Updates(map[string]any{"name": "a", "number": 2}).Error
+			},
+			want: map[string]bool{"Name": false, "Number": true, "any": true},
+		},
+		{
+			name: "column",
+			update: func(db *gorm.DB, d *hookedDoc) error {
+				return db.Model(d).Update("number", 1).Error
+			},
+			want: map[string]bool{"Name": false, "Number": false, "any": false},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, Config{})
+			d := &hookedDoc{ID: 1, Name: "a", Number: 1}
+			seedEntity(t, db, d)
+
+			if err := tt.update(db, d); err != nil {
+				t.Fatal(err)
+			}
+			if d.changed == nil {
+				t.Fatal("BeforeUpdate was not called")
+			}
+			for field, want := range tt.want {
+				if got := d.changed[field]; got != want {
+					t.Errorf("Changed(%s) = %v; want %v", field, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package gormup
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"math/big"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/shockerli/cvt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+type Comparator func(a, b any) bool
+
+type Comparators struct {
+	sync.RWMutex
+
+	byType     map[reflect.Type]Comparator
+	byDataType map[string]Comparator
+}
+
+func NewComparators(dialect string) *Comparators {
+	c := &Comparators{
+		byType:     map[reflect.Type]Comparator{},
+		byDataType: map[string]Comparator{},
+	}
+
+	c.RegisterDataType("json", JSONComparator)
+	c.RegisterDataType("jsonb", JSONComparator)
+	c.RegisterDataType(string(schema.Float), FloatComparator)
+	c.RegisterDataType(string(schema.Bytes), BytesComparator)
+	c.RegisterDataType(string(schema.Time), TimeComparator(dialectTimePrecision(dialect)))
+
+	return c
+}
+
+// newDialectorComparators учитывает точность времени, настроенную в драйвере
+func newDialectorComparators(d gorm.Dialector) *Comparators {
+	c := NewComparators(d.Name())
+	if precision, ok := driverTimePrecision(d); ok {
+		c.RegisterDataType(string(schema.Time), TimeComparator(precision))
+	}
+	return c
+}
+
+func (c *Comparators) RegisterType(t reflect.Type, cmp Comparator) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.byType[t] = cmp
+}
+
+func (c *Comparators) RegisterDataType(dataType string, cmp Comparator) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.byDataType[dataType] = cmp
+}
+
+func (c *Comparators) Equal(f *schema.Field, a, b any) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if ad, ok := a.(digest); ok {
+		bd, ok := b.(digest)
+		return ok && ad == bd
+	}
+	if cmp := c.lookup(f); cmp != nil {
+		return cmp(a, b)
+	}
+	return isEqualValue(a, b)
+}
+
+func (c *Comparators) lookup(f *schema.Field) Comparator {
+	if c == nil || f == nil {
+		return nil
+	}
+
+	c.RLock()
+	defer c.RUnlock()
+
+	t := f.FieldType
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if cmp, ok := c.byType[t]; ok {
+		return cmp
+	}
+	if cmp, ok := c.byDataType[string(f.DataType)]; ok {
+		return cmp
+	}
+	if cmp, ok := c.byDataType[string(f.GORMDataType)]; ok {
+		return cmp
+	}
+	return nil
+}
+
+func JSONComparator(a, b any) bool {
+	var av, bv any
+	if err := unmarshalJSON(toJSON(a), &av); err != nil {
+		return isEqualValue(a, b)
+	}
+	if err := unmarshalJSON(toJSON(b), &bv); err != nil {
+		return isEqualValue(a, b)
+	}
+	return isEqualJSON(av, bv)
+}
+
+func FloatComparator(a, b any) bool {
+	af, err := cvt.Float64E(a)
+	if err != nil {
+		return isEqualValue(a, b)
+	}
+	bf, err := cvt.Float64E(b)
+	if err != nil {
+		return isEqualValue(a, b)
+	}
+	if af == bf {
+		return true
+	}
+
+	// допуск относительный; абсолютный порог — только у самого нуля,
+	// иначе малые значения сливались бы с нулем и друг с другом
+	epsilon, floor := 1e-9, 0x1p-1022
+	_, aIsFloat32 := a.(float32)
+	_, bIsFloat32 := b.(float32)
+	if aIsFloat32 || bIsFloat32 {
+		epsilon, floor = 1e-6, 0x1p-126
+	}
+	return math.Abs(af-bf) <= math.Max(floor, epsilon*math.Max(math.Abs(af), math.Abs(bf)))
+}
+
+func BytesComparator(a, b any) bool {
+	ab, aok := a.([]byte)
+	bb, bok := b.([]byte)
+	if !aok || !bok {
+		return isEqualValue(a, b)
+	}
+	// nil пишется как NULL, пустой срез — как пустое значение
+	return (ab == nil) == (bb == nil) && bytes.Equal(ab, bb)
+}
+
+func TimeComparator(precision time.Duration) Comparator {
+	return func(a, b any) bool {
+		at, aok := a.(time.Time)
+		bt, bok := b.(time.Time)
+		if !aok || !bok {
+			return isEqualValue(a, b)
+		}
+		if precision > 0 {
+			// БД округляет дробные секунды, а не отбрасывает
+			at, bt = at.Round(precision), bt.Round(precision)
+		}
+		return at.Equal(bt)
+	}
+}
+
+func toJSON(v any) []byte {
+	switch v := v.(type) {
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	}
+	b, _ := json.Marshal(v)
+	return b
+}
+
+// unmarshalJSON разбирает числа в json.Number: через float64 большие
+// целые теряют точность и разные значения сливаются
+func unmarshalJSON(data []byte, out any) error {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(out); err != nil {
+		return err
+	}
+	if _, err := d.Token(); err != io.EOF {
+		return errors.New("json: trailing data")
+	}
+	return nil
+}
+
+// isEqualJSON сравнивает разобранные документы, числа — по значению
+func isEqualJSON(a, b any) bool {
+	switch av := a.(type) {
+	case json.Number:
+		bv, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		if av == bv {
+			return true
+		}
+		ar, aok := new(big.Rat).SetString(string(av))
+		br, bok := new(big.Rat).SetString(string(bv))
+		return aok && bok && ar.Cmp(br) == 0
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for k, v := range av {
+			if w, ok := bv[k]; !ok || !isEqualJSON(v, w) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		bv, ok := b.([]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !isEqualJSON(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func dialectTimePrecision(dialect string) time.Duration {
+	switch dialect {
+	case "postgres":
+		return time.Microsecond
+	case "mysql":
+		// datetime(3) — умолчание gorm для mysql
+		return time.Millisecond
+	case "sqlserver":
+		return 100 * time.Nanosecond
+	}
+	return 0
+}
+
+// driverTimePrecision читает DefaultDatetimePrecision из конфигурации
+// драйвера (mysql.Config), не импортируя сам драйвер.
+func driverTimePrecision(d gorm.Dialector) (time.Duration, bool) {
+	v := reflect.Indirect(reflect.ValueOf(d))
+	if v.Kind() != reflect.Struct {
+		return 0, false
+	}
+	sf, ok := v.Type().FieldByName("DefaultDatetimePrecision")
+	if !ok {
+		return 0, false
+	}
+	fv, err := v.FieldByIndexErr(sf.Index)
+	if err != nil {
+		return 0, false
+	}
+	fv = reflect.Indirect(fv)
+	if !fv.IsValid() || !fv.CanInt() {
+		return 0, false
+	}
+	digits := fv.Int()
+	if digits < 0 || digits > 9 {
+		return 0, false
+	}
+	return time.Duration(math.Pow10(9 - int(digits))), true
+}
@@ -0,0 +1,93 @@
+package gormup
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFloatComparator(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b any
+		want bool
+	}{
+		{name: "equal", a: 1.5, b: 1.5, want: true},
+		{name: "rounding noise", a: 0.1 + 0.2, b: 0.3, want: true},
+		{name: "large values", a: 1e12, b: 1e12 + 1e-4, want: true},
+		{name: "float32 snapshot", a: float32(0.1), b: 0.1, want: true},
+		{name: "zero and small", a: 0.0, b: 5e-10},
+		{name: "small values", a: 1e-12, b: 2e-12},
+		{name: "float32 below one", a: float32(0.1), b: float32(0.1000005)},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FloatComparator(tt.a, tt.b); got != tt.want {
+				t.Errorf("FloatComparator(%v, %v) = %v; want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComparators(t *testing.T) {
+	base := time.Date(2024, 1, 2, 3, 4, 5, 123456789, time.UTC)
+	cases := []struct {
+		name string
+		cmp  Comparator
+		a, b any
+		want bool
+	}{
+		{name: "json key order", cmp: JSONComparator, a: `{"a":1,"b":2}`, b: []byte(`{"b":2,"a":1}`), want: true},
+		{name: "json value", cmp: JSONComparator, a: `{"a":1}`, b: `{"a":2}`},
+		{name: "json not parsed", cmp: JSONComparator, a: "x", b: "x", want: true},
+		{name: "bytes", cmp: BytesComparator, a: []byte("ab"), b: []byte("ab"), want: true},
+		{name: "bytes nil and empty", cmp: BytesComparator, a: []byte(nil), b: []byte{}},
+		{name: "time zone", cmp: TimeComparator(0), a: base, b: base.In(time.FixedZone("X", 3600)), want: true},
+		{name: "time exact", cmp: TimeComparator(0), a: base, b: base.Add(time.Nanosecond)},
+		{name: "time rounded", cmp: TimeComparator(time.Microsecond), a: base, b: base.Add(300 * time.Nanosecond), want: true},
+		{name: "time rounded up", cmp: TimeComparator(time.Microsecond), a: base, b: base.Add(time.Microsecond)},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cmp(tt.a, tt.b); got != tt.want {
+				t.Errorf("cmp(%v, %v) = %v; want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+type cents int64
+
+type pricedDoc struct {
+	ID    uint64 `gorm:"primaryKey"`
+	Price cents
+	Meta  string `gorm:"type:jsonb"`
+}
+
+func TestComparatorsLookup(t *testing.T) {
+	db, fake := openTestDB(t, Config{})
+	p, _ := getPlugin(db)
+	// цены сравниваем с точностью до рубля
+	p.config.Comparators.RegisterType(reflect.TypeOf(cents(0)), func(a, b any) bool {
+		return a.(cents)/100 == b.(cents)/100
+	})
+
+	d := &pricedDoc{ID: 1, Price: 1000, Meta: `{"a":1,"b":2}`}
+	seedEntity(t, db, d)
+
+	d.Price, d.Meta = 1050, `{"b":2,"a":1}`
+	if err := db.Save(d).Error; err != nil {
+		t.Fatal(err)
+	}
+	if q := fake.take(); len(q) != 0 {
+		t.Fatalf("queries = %v; want none", q)
+	}
+
+	d.Price = 1100
+	if err := db.Save(d).Error; err != nil {
+		t.Fatal(err)
+	}
+	if q := fake.take(); len(q) != 1 || q[0].SQL != "UPDATE `priced_docs` SET `price`=? WHERE `id` = ?" {
+		t.Fatalf("queries = %v", q)
+	}
+}
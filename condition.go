@@ -0,0 +1,331 @@
+package gormup
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+type tokenKind int
+
+const (
+	tokenIdent tokenKind = iota
+	tokenDot
+	tokenEq
+	tokenIn
+	tokenParam
+	tokenNamed
+	tokenOpen
+	tokenClose
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// tokenize разбирает простое условие вида `"docs"."id" = ?` или `d.id IN (@ids)`.
+// На всем, что выходит за эти рамки, возвращает false.
+func tokenize(s string) ([]token, bool) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '.':
+			tokens = append(tokens, token{kind: tokenDot})
+			i++
+		case c == '=':
+			tokens = append(tokens, token{kind: tokenEq})
+			i++
+		case c == '?':
+			tokens = append(tokens, token{kind: tokenParam})
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenOpen})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenClose})
+			i++
+		case c == '`' || c == '"' || c == '[':
+			closing := byte(c)
+			if c == '[' {
+				closing = ']'
+			}
+			end := strings.IndexByte(s[i+1:], closing)
+			if end < 0 {
+				return nil, false
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: s[i+1 : i+1+end]})
+			i += end + 2
+		case c == '@':
+			j := i + 1
+			for j < len(s) && isIdentChar(rune(s[j])) {
+				j++
+			}
+			if j == i+1 {
+				return nil, false
+			}
+			tokens = append(tokens, token{kind: tokenNamed, text: s[i+1 : j]})
+			i = j
+		case isIdentChar(c):
+			j := i
+			for j < len(s) && isIdentChar(rune(s[j])) {
+				j++
+			}
+			word := s[i:j]
+			if strings.EqualFold(word, "in") {
+				tokens = append(tokens, token{kind: tokenIn})
+			} else {
+				tokens = append(tokens, token{kind: tokenIdent, text: word})
+			}
+			i = j
+		default:
+			return nil, false
+		}
+	}
+	return tokens, true
+}
+
+func isIdentChar(c rune) bool {
+	return c == '_' || c == '$' || unicode.IsLetter(c) || unicode.IsDigit(c)
+}
+
+type keyCondition struct {
+	qualifier string
+	column    string
+	in        bool
+	// имя параметра для @name, пусто для ?
+	named string
+}
+
+func parseKeyCondition(s string) (keyCondition, bool) {
+	tokens, ok := tokenize(s)
+	if !ok {
+		return keyCondition{}, false
+	}
+
+	var cond keyCondition
+	var idents []string
+	i := 0
+	for ; i < len(tokens); i++ {
+		if tokens[i].kind != tokenIdent {
+			return keyCondition{}, false
+		}
+		idents = append(idents, tokens[i].text)
+		if i+1 < len(tokens) && tokens[i+1].kind == tokenDot {
+			i++
+			continue
+		}
+		i++
+		break
+	}
+	if len(idents) == 0 || i >= len(tokens) {
+		return keyCondition{}, false
+	}
+	cond.column = idents[len(idents)-1]
+	cond.qualifier = strings.Join(idents[:len(idents)-1], ".")
+
+	switch tokens[i].kind {
+	case tokenEq:
+	case tokenIn:
+		cond.in = true
+	default:
+		return keyCondition{}, false
+	}
+	rest := tokens[i+1:]
+
+	// IN (?) равнозначно IN ?
+	if cond.in && len(rest) == 3 && rest[0].kind == tokenOpen && rest[2].kind == tokenClose {
+		rest = rest[1:2]
+	}
+	if len(rest) != 1 {
+		return keyCondition{}, false
+	}
+	switch rest[0].kind {
+	case tokenParam:
+	case tokenNamed:
+		cond.named = rest[0].text
+	default:
+		return keyCondition{}, false
+	}
+	return cond, true
+}
+
+// matchQualifier проверяет, что квалификатор колонки указывает на таблицу запроса:
+// по имени таблицы (с схемой или без) либо по ее псевдониму.
+func matchQualifier(st *gorm.Statement, qualifier string) bool {
+	if qualifier == "" {
+		return true
+	}
+	names := []string{st.Table}
+	if st.Schema != nil {
+		names = append(names, st.Schema.Table)
+		if table, ok := effectiveTable(st, st.Schema); ok {
+			names = append(names, table)
+		}
+	}
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		if strings.EqualFold(qualifier, name) {
+			return true
+		}
+		if i := strings.LastIndexByte(name, '.'); i >= 0 && strings.EqualFold(qualifier, name[i+1:]) {
+			return true
+		}
+	}
+	if alias := tableAlias(st); alias != "" && strings.EqualFold(qualifier, alias) {
+		return true
+	}
+	return false
+}
+
+// tableAlias достает псевдоним из Table("documents d") или Table("documents AS d").
+func tableAlias(st *gorm.Statement) string {
+	if st.TableExpr == nil {
+		return ""
+	}
+	_, alias, _ := parseTableExpr(st.TableExpr.SQL)
+	return alias
+}
+
+// effectiveTable возвращает таблицу, из которой фактически читает запрос.
+// Statement.Table для "documents AS d" содержит псевдоним, а для "docs.documents"
+// теряет схему, поэтому имя берется из TableExpr.
+func effectiveTable(st *gorm.Statement, sch *schema.Schema) (string, bool) {
+	if st.TableExpr != nil {
+		if len(st.TableExpr.Vars) > 0 {
+			return "", false
+		}
+		table, _, ok := parseTableExpr(st.TableExpr.SQL)
+		return table, ok
+	}
+	if st.Table != "" {
+		return st.Table, true
+	}
+	return sch.Table, true
+}
+
+// parseTableExpr разбирает `schema.table [AS] alias`; подзапросы и списки таблиц не принимает.
+func parseTableExpr(s string) (table, alias string, ok bool) {
+	tokens, ok := tokenize(s)
+	if !ok {
+		return "", "", false
+	}
+
+	var idents []string
+	i := 0
+	for ; i < len(tokens); i++ {
+		if tokens[i].kind != tokenIdent {
+			return "", "", false
+		}
+		idents = append(idents, tokens[i].text)
+		if i+1 < len(tokens) && tokens[i+1].kind == tokenDot {
+			i++
+			continue
+		}
+		i++
+		break
+	}
+	if len(idents) == 0 {
+		return "", "", false
+	}
+
+	rest := tokens[i:]
+	if len(rest) == 2 && rest[0].kind == tokenIdent && strings.EqualFold(rest[0].text, "as") {
+		rest = rest[1:]
+	}
+	switch {
+	case len(rest) == 0:
+	case len(rest) == 1 && rest[0].kind == tokenIdent:
+		alias = rest[0].text
+	default:
+		return "", "", false
+	}
+	return strings.Join(idents, "."), alias, true
+}
+
+// conditionValues раскладывает значение параметра: для IN — элементы среза.
+func conditionValues(v any, in bool) ([]string, bool) {
+	rv := reflect.ValueOf(v)
+	isList := rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array
+	if isList && rv.Type().Elem().Kind() == reflect.Uint8 {
+		isList = false
+	}
+	if !isList {
+		return []string{toString(v)}, true
+	}
+	if !in {
+		return nil, false
+	}
+	values := make([]string, rv.Len())
+	for i := range values {
+		values[i] = toString(rv.Index(i).Interface())
+	}
+	return uniqueValues(values), true
+}
+
+// uniqueValues убирает повторы ключей: IN (1, 1) в БД вернет одну строку.
+func uniqueValues(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	out := values[:0]
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func namedValue(vars []any, name string) (any, bool) {
+	for _, v := range vars {
+		switch nv := v.(type) {
+		case sql.NamedArg:
+			if nv.Name == name {
+				return nv.Value, true
+			}
+		case map[string]any:
+			if value, ok := nv[name]; ok {
+				return value, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func extractExprValues(st *gorm.Statement, columnName string, sql string, vars []any, named bool) ([]string, bool) {
+	cond, ok := parseKeyCondition(sql)
+	if !ok || !strings.EqualFold(cond.column, columnName) || !matchQualifier(st, cond.qualifier) {
+		return nil, false
+	}
+
+	var value any
+	if cond.named != "" {
+		if !named {
+			return nil, false
+		}
+		if value, ok = namedValue(vars, cond.named); !ok {
+			return nil, false
+		}
+	} else {
+		if len(vars) != 1 {
+			return nil, false
+		}
+		value = vars[0]
+	}
+
+	switch value.(type) {
+	case clause.Expression, *gorm.DB, nil:
+		return nil, false
+	}
+	return conditionValues(value, cond.in)
+}
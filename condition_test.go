@@ -0,0 +1,125 @@
+package gormup
+
+import (
+	"database/sql"
+	"slices"
+	"testing"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func TestParseKeyCondition(t *testing.T) {
+	cases := []struct {
+		sql  string
+		want keyCondition
+		ok   bool
+	}{
+		{sql: "id = ?", want: keyCondition{column: "id"}, ok: true},
+		{sql: "`id` = ?", want: keyCondition{column: "id"}, ok: true},
+		{sql: `"docs"."id" = ?`, want: keyCondition{qualifier: "docs", column: "id"}, ok: true},
+		{sql: "[docs].[id]=?", want: keyCondition{qualifier: "docs", column: "id"}, ok: true},
+		{sql: "public.docs.id = ?", want: keyCondition{qualifier: "public.docs", column: "id"}, ok: true},
+		{sql: "d.id IN ?", want: keyCondition{qualifier: "d", column: "id", in: true}, ok: true},
+		{sql: "id in (?)", want: keyCondition{column: "id", in: true}, ok: true},
+		{sql: "id = @id", want: keyCondition{column: "id", named: "id"}, ok: true},
+		{sql: "id IN (@ids)", want: keyCondition{column: "id", in: true, named: "ids"}, ok: true},
+		{sql: "id = ? OR id = ?"},
+		{sql: "id > ?"},
+		{sql: "id = 1"},
+		{sql: "id IN (?, ?)"},
+		{sql: "lower(name) = ?"},
+		{sql: "`id = ?"},
+		{sql: "id = @"},
+		{sql: "= ?"},
+	}
+	for _, tt := range cases {
+		got, ok := parseKeyCondition(tt.sql)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseKeyCondition(%q) = %+v, %v; want %+v, %v", tt.sql, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseTableExpr(t *testing.T) {
+	cases := []struct {
+		sql   string
+		table string
+		alias string
+		ok    bool
+	}{
+		{sql: "documents", table: "documents", ok: true},
+		{sql: "documents d", table: "documents", alias: "d", ok: true},
+		{sql: "documents AS d", table: "documents", alias: "d", ok: true},
+		{sql: `"docs"."documents" as "d"`, table: "docs.documents", alias: "d", ok: true},
+		{sql: "documents, users"},
+		{sql: "(SELECT * FROM documents) d"},
+		{sql: "documents d JOIN users u"},
+	}
+	for _, tt := range cases {
+		table, alias, ok := parseTableExpr(tt.sql)
+		if ok != tt.ok || table != tt.table || alias != tt.alias {
+			t.Errorf("parseTableExpr(%q) = %q, %q, %v; want %q, %q, %v",
+				tt.sql, table, alias, ok, tt.table, tt.alias, tt.ok)
+		}
+	}
+}
+
+func TestMatchQualifier(t *testing.T) {
+	aliased := &gorm.Statement{Table: "d", TableExpr: &clause.Expr{SQL: "docs.documents AS d"}}
+	plain := &gorm.Statement{Table: "documents"}
+
+	cases := []struct {
+		st        *gorm.Statement
+		qualifier string
+		want      bool
+	}{
+		{st: plain, qualifier: "", want: true},
+		{st: plain, qualifier: "documents", want: true},
+		{st: plain, qualifier: "DOCUMENTS", want: true},
+		{st: plain, qualifier: "users", want: false},
+		{st: aliased, qualifier: "d", want: true},
+		{st: aliased, qualifier: "documents", want: false},
+		{st: aliased, qualifier: "u", want: false},
+	}
+	for _, tt := range cases {
+		if got := matchQualifier(tt.st, tt.qualifier); got != tt.want {
+			t.Errorf("matchQualifier(%q, %q) = %v; want %v", tt.st.Table, tt.qualifier, got, tt.want)
+		}
+	}
+}
+
+func TestConditionValues(t *testing.T) {
+	cases := []struct {
+		v    any
+		in   bool
+		want []string
+		ok   bool
+	}{
+		{v: 1, want: []string{"1"}, ok: true},
+		{v: "a", want: []string{"a"}, ok: true},
+		{v: []int{1, 2, 1}, in: true, want: []string{"1", "2"}, ok: true},
+		{v: []byte("ab"), want: []string{"ab"}, ok: true},
+		{v: []int{1}},
+	}
+	for _, tt := range cases {
+		got, ok := conditionValues(tt.v, tt.in)
+		if ok != tt.ok || !slices.Equal(got, tt.want) {
+			t.Errorf("conditionValues(%v, %v) = %v, %v; want %v, %v", tt.v, tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestNamedValue(t *testing.T) {
+	vars := []any{sql.Named("id", 1), map[string]any{"ids": []int{2, 3}}}
+
+	if v, ok := namedValue(vars, "id"); !ok || v != 1 {
+		t.Errorf("namedValue(id) = %v, %v", v, ok)
+	}
+	if v, ok := namedValue(vars, "ids"); !ok || !slices.Equal(v.([]int), []int{2, 3}) {
+		t.Errorf("namedValue(ids) = %v, %v", v, ok)
+	}
+	if _, ok := namedValue(vars, "name"); ok {
+		t.Error("namedValue(name) found a missing parameter")
+	}
+}
@@ -1,8 +1,20 @@
 package gormup
 
+import "gorm.io/gorm"
+
 type Config struct {
 	Store               Store
 	WithoutQueryCache   bool
 	WithoutReduceUpdate bool
+	CompareAndSet       bool
+	WriteSelected       bool
+	PatchJSONB          bool
+	Strict              bool
 	OtherPrimaryKeys    map[string][]string
+	VersionColumns      map[string]string
+	Audit               Audit
+	Outbox              *Outbox
+	Comparators         *Comparators
+	Policy              Policy
+	KeyNamespace        func(db *gorm.DB) string
 }
@@ -0,0 +1,70 @@
+package gormup
+
+import (
+	"reflect"
+
+	"gorm.io/gorm"
+)
+
+type DryRunReport struct {
+	SQL       string
+	Vars      []any
+	Changes   []Change
+	Skipped   bool
+	FromCache bool
+
+	restore []func()
+}
+
+// DryRun строит запрос со всеми решениями плагина, но не выполняет его
+// и не трогает кеш, снимки и модель. Итог — в Preview.
+func DryRun(db *gorm.DB) *gorm.DB {
+	return db.Session(&gorm.Session{DryRun: true, SkipDefaultTransaction: true})
+}
+
+func Preview(db *gorm.DB) *DryRunReport {
+	v, ok := db.Get(dryRunKey)
+	if !ok {
+		return nil
+	}
+	r, _ := v.(*DryRunReport)
+	return r
+}
+
+func (p *plugin) dryRun(db *gorm.DB) bool {
+	return db.DryRun
+}
+
+func (p *plugin) getReport(db *gorm.DB) *DryRunReport {
+	if r := Preview(db); r != nil {
+		return r
+	}
+	r := &DryRunReport{}
+	db.Set(dryRunKey, r)
+	return r
+}
+
+// keepDest запоминает модель до обновления: gorm и плагин пишут в нее
+// updated_at и версию, а в dry run модель должна остаться прежней.
+func (p *plugin) keepDest(db *gorm.DB) {
+	rv := db.Statement.ReflectValue
+	if rv.Kind() != reflect.Struct || !rv.CanSet() {
+		return
+	}
+	saved := reflect.New(rv.Type()).Elem()
+	saved.Set(rv)
+
+	r := p.getReport(db)
+	r.restore = append(r.restore, func() { rv.Set(saved) })
+}
+
+func (p *plugin) finishReport(db *gorm.DB) {
+	r := p.getReport(db)
+	r.SQL = db.Statement.SQL.String()
+	r.Vars = db.Statement.Vars
+
+	for i := len(r.restore) - 1; i >= 0; i-- {
+		r.restore[i]()
+	}
+	r.restore = nil
+}
@@ -0,0 +1,72 @@
+package gormup
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDryRunUpdate(t *testing.T) {
+	db, fake := openTestDB(t, Config{})
+	updatedAt := time.Now().Add(-time.Hour)
+	d := &auditedDoc{ID: 1, Name: "a", Number: 1, UpdatedBy: "u", UpdatedAt: updatedAt}
+	seedEntity(t, db, d)
+
+	tx := DryRun(db).Save(d)
+	if tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	if r := Preview(tx); r == nil || !r.Skipped {
+		t.Fatalf("Preview() = %+v; want skipped", r)
+	}
+
+	d.Name = "b"
+	tx = DryRun(db).Save(d)
+	if tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	r := Preview(tx)
+	if r == nil || r.Skipped || r.SQL != "UPDATE `audited_docs` SET `name`=?,`updated_by`=?,`updated_at`=? WHERE `id` = ?" {
+		t.Fatalf("Preview() = %+v", r)
+	}
+	if len(r.Vars) != 4 || r.Vars[0] != "b" {
+		t.Errorf("vars = %v", r.Vars)
+	}
+	if len(r.Changes) == 0 || r.Changes[0].Column != "name" || r.Changes[0].Old != "a" || r.Changes[0].New != "b" {
+		t.Errorf("changes = %+v", r.Changes)
+	}
+
+	// ни запроса, ни правок модели и снимка
+	if q := fake.take(); len(q) != 0 {
+		t.Errorf("queries = %v; want none", q)
+	}
+	if !d.UpdatedAt.Equal(updatedAt) {
+		t.Errorf("updated_at = %v; want it untouched", d.UpdatedAt)
+	}
+	if err := db.Save(d).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n := fake.count("UPDATE"); n != 1 {
+		t.Errorf("updates after dry run = %d; want 1", n)
+	}
+}
+
+func TestDryRunQuery(t *testing.T) {
+	db, fake := openTestDB(t, Config{})
+	seedEntity(t, db, &testDoc{ID: 1, Name: "a", Number: 1})
+
+	var cached testDoc
+	r := Preview(DryRun(db).Find(&cached, "id = ?", 1))
+	if r == nil || !r.FromCache {
+		t.Errorf("Preview() = %+v; want from cache", r)
+	}
+
+	var missed testDoc
+	r = Preview(DryRun(db).Find(&missed, "id = ?", 2))
+	if r == nil || r.FromCache || r.SQL != "SELECT * FROM `test_docs` WHERE id = ?" || !reflect.DeepEqual(r.Vars, []any{2}) {
+		t.Errorf("Preview() = %+v", r)
+	}
+	if q := fake.take(); len(q) != 0 {
+		t.Errorf("queries = %v; want none", q)
+	}
+}
@@ -0,0 +1,92 @@
+package gormup
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestEffectiveTableKeys(t *testing.T) {
+	db, fake := openTestDB(t, Config{})
+	fake.rows(testDocColumns, []driver.Value{int64(1), "shard", int64(1)})
+	var d testDoc
+	if err := db.Table("test_docs_2024").Find(&d, "id = ?", 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	fake.take()
+
+	cases := []struct {
+		name   string
+		table  string
+		cached bool
+	}{
+		{name: "same shard", table: "test_docs_2024", cached: true},
+		{name: "other shard", table: "test_docs_2025"},
+		{name: "base table"},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := db
+			if tt.table != "" {
+				tx = db.Table(tt.table)
+			}
+			fake.rows(testDocColumns, []driver.Value{int64(1), "other", int64(1)})
+			var got testDoc
+			if err := tx.Find(&got, "id = ?", 1).Error; err != nil {
+				t.Fatal(err)
+			}
+			if cached := fake.count("SELECT") == 0; cached != tt.cached {
+				t.Errorf("cached = %v; want %v", cached, tt.cached)
+			}
+		})
+	}
+}
+
+type tenantKey struct{}
+
+func TestKeyNamespace(t *testing.T) {
+	db, fake := openTestDB(t, Config{KeyNamespace: func(db *gorm.DB) string {
+		tenant, _ := db.Statement.Context.Value(tenantKey{}).(string)
+		return tenant
+	}})
+	acme := db.WithContext(context.WithValue(db.Statement.Context, tenantKey{}, "acme"))
+	globex := db.WithContext(context.WithValue(db.Statement.Context, tenantKey{}, "globex"))
+
+	fake.rows(testDocColumns, []driver.Value{int64(1), "acme doc", int64(1)})
+	var d testDoc
+	if err := acme.Find(&d, "id = ?", 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	fake.take()
+
+	if err := acme.Find(&d, "id = ?", 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n := fake.count("SELECT"); n != 0 {
+		t.Errorf("select count = %d; want a cache hit in the same namespace", n)
+	}
+
+	fake.rows(testDocColumns, []driver.Value{int64(1), "globex doc", int64(1)})
+	var other testDoc
+	if err := globex.Find(&other, "id = ?", 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n := fake.count("SELECT"); n != 1 || other.Name != "globex doc" {
+		t.Errorf("select count = %d, name = %q; want the other namespace read from the database", n, other.Name)
+	}
+
+	// запись в одном пространстве не трогает снимок другого
+	other.Number = 2
+	if err := globex.Save(&other).Error; err != nil {
+		t.Fatal(err)
+	}
+	fake.take()
+	if err := acme.Find(&d, "id = ?", 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n := fake.count("SELECT"); n != 0 || d.Name != "acme doc" || d.Number != 1 {
+		t.Errorf("select count = %d, doc = %+v; want the acme snapshot intact", n, d)
+	}
+}
@@ -5,22 +5,32 @@ import (
 	"fmt"
 	"reflect"
 
+	"gorm.io/gorm"
 	"gorm.io/gorm/schema"
 )
 
 type entity struct {
+	table        entityTable
 	schema       *schema.Schema
 	reflectValue reflect.Value
 
 	primaryKey       string
 	otherPrimaryKeys []string
 
-	id     string
-	fields map[string]string
+	id          string
+	fields      map[string]any
+	comparators *Comparators
+
+	// колонки, значение которых в БД вычислено выражением и локально неизвестно
+	unknown map[string]bool
+
+	// транзакция, в которой строка прочитана с блокировкой
+	lockedBy gorm.ConnPool
 }
 
 func createEntity(
 	ctx context.Context,
+	table entityTable,
 	sch *schema.Schema,
 	otherPrimaryKeys []string,
 	v reflect.Value,
@@ -36,6 +46,7 @@ func createEntity(
 	}
 
 	e := &entity{
+		table:            table,
 		schema:           sch,
 		primaryKey:       sch.PrioritizedPrimaryField.DBName,
 		otherPrimaryKeys: otherPrimaryKeys,
@@ -54,7 +65,7 @@ func createEntity(
 }
 
 func (e *entity) GetKey() string {
-	return getEntityKey(e.schema.Table, e.primaryKey, e.id)
+	return getEntityKey(e.table.key(), e.primaryKey, e.id)
 }
 
 func (e *entity) GetOtherKeys() (keys []string) {
@@ -63,8 +74,8 @@ func (e *entity) GetOtherKeys() (keys []string) {
 			continue
 		}
 		v, ok := e.fields[pk]
-		if ok {
-			keys = append(keys, getEntityKey(e.schema.Table, pk, v))
+		if ok && v != nil {
+			keys = append(keys, getEntityKey(e.table.key(), pk, toString(v)))
 		}
 	}
 	return
@@ -74,26 +85,122 @@ func (e *entity) Value() any {
 	return e.reflectValue.Interface()
 }
 
+func (e *entity) Model() any {
+	if e.reflectValue.Kind() == reflect.Struct && e.reflectValue.CanAddr() {
+		return e.reflectValue.Addr().Interface()
+	}
+	return e.reflectValue.Interface()
+}
+
 func (e *entity) Sync(ctx context.Context) *entity {
 	if e == nil {
 		return nil
 	}
 
-	e.fields = make(map[string]string)
-	for _, f := range e.schema.Fields {
-		if f.DBName == "" ||
-			!f.Updatable ||
-			f.AutoUpdateTime > 0 ||
-			f.PrimaryKey {
+	e.fields = make(map[string]any)
+	for _, f := range e.trackedFields() {
+		e.fields[f.DBName] = e.fieldValue(ctx, f)
+	}
+
+	return e
+}
+
+func (e *entity) SyncColumns(ctx context.Context, columns ...string) *entity {
+	if e == nil {
+		return nil
+	}
+	if e.fields == nil {
+		e.fields = make(map[string]any)
+	}
+
+	for _, column := range columns {
+		f, ok := e.schema.FieldsByDBName[column]
+		if !ok || !isTrackedField(f) {
 			continue
 		}
-		value, _ := f.ValueOf(ctx, e.reflectValue)
-		e.fields[f.DBName] = toString(value)
+		e.fields[f.DBName] = e.fieldValue(ctx, f)
 	}
 
 	return e
 }
 
+func (e *entity) ChangedColumns(ctx context.Context) (columns []string) {
+	if e == nil {
+		return nil
+	}
+
+	for _, f := range e.trackedFields() {
+		if !e.comparators.Equal(f, e.fieldValue(ctx, f), e.fields[f.DBName]) {
+			columns = append(columns, f.DBName)
+		}
+	}
+
+	return columns
+}
+
+func (e *entity) trackedFields() (out []*schema.Field) {
+	for _, f := range e.schema.Fields {
+		if isTrackedField(f) {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+func (e *entity) fieldValue(ctx context.Context, f *schema.Field) any {
+	if f.Serializer != nil {
+		value := f.ReflectValueOf(ctx, e.reflectValue).Interface()
+		return toFieldSnapshot(f, serializeValue(ctx, f, e.reflectValue, value))
+	}
+	value, _ := f.ValueOf(ctx, e.reflectValue)
+	return toFieldSnapshot(f, value)
+}
+
+// dropNoCache отвязывает сущность от модели вызывающего, если в ней есть
+// nocache-поля: в сторе остается копия без них
+func (e *entity) dropNoCache(ctx context.Context) {
+	if e == nil || !hasNoCacheFields(e.schema) {
+		return
+	}
+	e.reflectValue = withoutNoCache(ctx, e.schema, e.reflectValue)
+}
+
+func (e *entity) MarkUnknown(column string) {
+	if e.unknown == nil {
+		e.unknown = make(map[string]bool)
+	}
+	e.unknown[column] = true
+}
+
+func (e *entity) MarkKnown(column string) {
+	delete(e.unknown, column)
+}
+
+func (e *entity) IsKnown(column string) bool {
+	return !e.unknown[column]
+}
+
+func isTrackedField(f *schema.Field) bool {
+	return f.DBName != "" &&
+		f.Updatable &&
+		!f.PrimaryKey &&
+		!getFieldPolicy(f).ignore
+}
+
+// entityTable — физическая таблица, из которой прочитана строка,
+// и префикс KeyNamespace, которым разделяются ключи кеша.
+type entityTable struct {
+	name      string
+	namespace string
+}
+
+func (t entityTable) key() string {
+	if t.namespace == "" {
+		return t.name
+	}
+	return t.namespace + ":" + t.name
+}
+
 func getEntityKey(table, column, value string) string {
 	return fmt.Sprintf("%s.%s=%s", table, column, value)
 }
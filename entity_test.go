@@ -0,0 +1,145 @@
+package gormup
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	"gorm.io/gorm/schema"
+)
+
+type nullDoc struct {
+	ID    uint64 `gorm:"primaryKey"`
+	Title *string
+	Note  sql.NullString
+	Tags  []byte
+}
+
+func TestNullSnapshots(t *testing.T) {
+	empty := ""
+	cases := []struct {
+		name   string
+		before nullDoc
+		change func(d *nullDoc)
+		sql    string
+	}{
+		{
+			name:   "nil pointer to empty",
+			change: func(d *nullDoc) { d.Title = &empty },
+			sql:    "UPDATE `null_docs` SET `title`=? WHERE `id` = ?",
+		},
+		{
+			name:   "empty to nil pointer",
+			before: nullDoc{Title: &empty},
+			change: func(d *nullDoc) { d.Title = nil },
+			sql:    "UPDATE `null_docs` SET `title`=? WHERE `id` = ?",
+		},
+		{
+			name:   "invalid null string to valid empty",
+			change: func(d *nullDoc) { d.Note = sql.NullString{Valid: true} },
+			sql:    "UPDATE `null_docs` SET `note`=? WHERE `id` = ?",
+		},
+		{
+			name:   "nil bytes to empty",
+			change: func(d *nullDoc) { d.Tags = []byte{} },
+			sql:    "UPDATE `null_docs` SET `tags`=? WHERE `id` = ?",
+		},
+		{
+			name:   "copied pointer",
+			before: nullDoc{Title: &empty},
+			change: func(d *nullDoc) { s := ""; d.Title = &s },
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := openTestDB(t, Config{})
+			d := tt.before
+			d.ID = 1
+			seedEntity(t, db, &d)
+
+			tt.change(&d)
+			if err := db.Save(&d).Error; err != nil {
+				t.Fatal(err)
+			}
+			q := fake.take()
+			switch {
+			case tt.sql == "" && len(q) != 0:
+				t.Errorf("queries = %v; want none", q)
+			case tt.sql != "" && (len(q) != 1 || q[0].SQL != tt.sql):
+				t.Errorf("queries = %v; want %q", q, tt.sql)
+			}
+		})
+	}
+}
+
+// secondsSerializer хранит время целыми секундами
+type secondsSerializer struct{}
+
+func (secondsSerializer) Scan(ctx context.Context, f *schema.Field, dst reflect.Value, dbValue any) error {
+	v, _ := dbValue.(int64)
+	return f.Set(ctx, dst, time.Unix(v, 0))
+}
+
+func (secondsSerializer) Value(ctx context.Context, f *schema.Field, dst reflect.Value, v any) (any, error) {
+	return v.(time.Time).Unix(), nil
+}
+
+func init() {
+	schema.RegisterSerializer("test_seconds", secondsSerializer{})
+}
+
+type serializedDoc struct {
+	ID      uint64         `gorm:"primaryKey"`
+	Meta    map[string]any `gorm:"serializer:json"`
+	Expires time.Time      `gorm:"serializer:test_seconds"`
+}
+
+func TestSerializedSnapshots(t *testing.T) {
+	expires := time.Unix(1700000000, 0)
+	cases := []struct {
+		name   string
+		change func(d *serializedDoc)
+		sql    string
+	}{
+		{
+			name:   "same document",
+			change: func(d *serializedDoc) { d.Meta = map[string]any{"b": "x", "a": 1} },
+		},
+		{
+			name:   "changed document",
+			change: func(d *serializedDoc) { d.Meta["a"] = 2 },
+			sql:    "UPDATE `serialized_docs` SET `meta`=? WHERE `id` = ?",
+		},
+		{
+			// в колонку попадают секунды: доли секунды не записываются
+			name:   "same stored seconds",
+			change: func(d *serializedDoc) { d.Expires = expires.Add(500 * time.Millisecond) },
+		},
+		{
+			name:   "changed stored seconds",
+			change: func(d *serializedDoc) { d.Expires = expires.Add(time.Second) },
+			sql:    "UPDATE `serialized_docs` SET `expires`=? WHERE `id` = ?",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := openTestDB(t, Config{})
+			d := &serializedDoc{ID: 1, Meta: map[string]any{"a": 1, "b": "x"}, Expires: expires}
+			seedEntity(t, db, d)
+
+			tt.change(d)
+			if err := db.Save(d).Error; err != nil {
+				t.Fatal(err)
+			}
+			q := fake.take()
+			switch {
+			case tt.sql == "" && len(q) != 0:
+				t.Errorf("queries = %v; want none", q)
+			case tt.sql != "" && (len(q) != 1 || q[0].SQL != tt.sql):
+				t.Errorf("queries = %v; want %q", q, tt.sql)
+			}
+		})
+	}
+}
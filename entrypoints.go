@@ -1,18 +1,39 @@
 package gormup
 
 import (
+	"errors"
+
 	"gorm.io/gorm"
 )
 
+const pluginName = "gormup"
+
+var ErrNotRegistered = errors.New("gormup is not registered")
+
 func Register(db *gorm.DB, cfg Config) {
 	if cfg.Store == nil {
 		cfg.Store = NewStore()
 	}
+	if cfg.Comparators == nil {
+		cfg.Comparators = newDialectorComparators(db.Dialector)
+	}
+	if cfg.Policy == nil {
+		cfg.Policy = DefaultPolicy{}
+	}
 	pl := &plugin{
 		config:   cfg,
 		entities: newEntityStore(cfg.Store),
 	}
 	pl.register(db)
+	db.Config.Plugins[pl.Name()] = pl
+}
+
+func getPlugin(db *gorm.DB) (*plugin, error) {
+	pl, ok := db.Config.Plugins[pluginName].(*plugin)
+	if !ok {
+		return nil, ErrNotRegistered
+	}
+	return pl, nil
 }
 
 func WithoutQueryCache(db *gorm.DB) *gorm.DB {
@@ -26,3 +47,41 @@ func WithoutReduceUpdate(db *gorm.DB) *gorm.DB {
 		return db.Set(withoutReduceUpdateKey, true)
 	})
 }
+
+func CompareAndSet(db *gorm.DB) *gorm.DB {
+	return db.Scopes(func(db *gorm.DB) *gorm.DB {
+		return db.Set(compareAndSetKey, true)
+	})
+}
+
+func WriteSelected(db *gorm.DB) *gorm.DB {
+	return db.Scopes(func(db *gorm.DB) *gorm.DB {
+		return db.Set(writeSelectedKey, true)
+	})
+}
+
+func PatchJSONB(db *gorm.DB) *gorm.DB {
+	return db.Scopes(func(db *gorm.DB) *gorm.DB {
+		return db.Set(patchJSONBKey, true)
+	})
+}
+
+func Strict(db *gorm.DB) *gorm.DB {
+	return db.Scopes(func(db *gorm.DB) *gorm.DB {
+		return db.Set(strictKey, true)
+	})
+}
+
+// Locked сообщает, что строка модели прочитана с блокировкой (FOR UPDATE/SHARE)
+// в текущей транзакции.
+func Locked(db *gorm.DB, model any) bool {
+	p, err := getPlugin(db)
+	if err != nil {
+		return false
+	}
+	ent, err := p.lookupEntity(db, model)
+	if err != nil || ent.lockedBy == nil {
+		return false
+	}
+	return ent.lockedBy == db.Statement.ConnPool
+}
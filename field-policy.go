@@ -0,0 +1,133 @@
+package gormup
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"gorm.io/gorm/schema"
+)
+
+const (
+	tagName = "gormup"
+
+	ignoreTag    = "-"
+	alwaysTag    = "ALWAYS"
+	immutableTag = "IMMUTABLE"
+	noCacheTag   = "NOCACHE"
+	versionTag   = "VERSION"
+)
+
+var ErrImmutableField = errors.New("immutable field changed")
+
+type fieldPolicy struct {
+	// не отслеживается и не сравнивается, пишется только вместе с другими изменениями
+	ignore bool
+	// пишется всегда, если в обновлении есть хоть одно изменение
+	always bool
+	// изменение после загрузки — ошибка
+	immutable bool
+	// значение не хранится ни в снимке (там только HMAC), ни в модели в сторе
+	noCache bool
+	version bool
+}
+
+var fieldPolicies sync.Map
+
+func getFieldPolicy(f *schema.Field) fieldPolicy {
+	if v, ok := fieldPolicies.Load(f); ok {
+		return v.(fieldPolicy)
+	}
+
+	settings := schema.ParseTagSetting(f.Tag.Get(tagName), ";")
+	has := func(name string) bool {
+		_, ok := settings[name]
+		return ok
+	}
+	fp := fieldPolicy{
+		ignore:    has(ignoreTag) || f.AutoUpdateTime > 0,
+		always:    has(alwaysTag),
+		immutable: has(immutableTag),
+		noCache:   has(noCacheTag),
+		version:   has(versionTag),
+	}
+
+	fieldPolicies.Store(f, fp)
+	return fp
+}
+
+type digest [sha256.Size]byte
+
+// ключ живет только в памяти процесса: по снимку из общего стора значение
+// не подобрать, а снимки других процессов просто считаются измененными
+var digestKey = func() []byte {
+	key := make([]byte, sha256.Size)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+func toFieldSnapshot(f *schema.Field, v any) any {
+	v = toSnapshotValue(v)
+	if v != nil && getFieldPolicy(f).noCache {
+		mac := hmac.New(sha256.New, digestKey)
+		mac.Write([]byte(toString(v)))
+		var d digest
+		copy(d[:], mac.Sum(nil))
+		return d
+	}
+	return v
+}
+
+var noCacheSchemas sync.Map
+
+func hasNoCacheFields(sch *schema.Schema) bool {
+	if sch == nil {
+		return false
+	}
+	if v, ok := noCacheSchemas.Load(sch); ok {
+		return v.(bool)
+	}
+	has := false
+	for _, f := range sch.Fields {
+		if getFieldPolicy(f).noCache {
+			has = true
+			break
+		}
+	}
+	noCacheSchemas.Store(sch, has)
+	return has
+}
+
+// withoutNoCache возвращает копию модели с обнуленными nocache-полями
+func withoutNoCache(ctx context.Context, sch *schema.Schema, rv reflect.Value) reflect.Value {
+	rv = reflect.Indirect(rv)
+	if rv.Kind() != reflect.Struct {
+		return rv
+	}
+	cp := reflect.New(rv.Type()).Elem()
+	cp.Set(rv)
+	for _, f := range sch.Fields {
+		if getFieldPolicy(f).noCache {
+			_ = f.Set(ctx, cp, nil)
+		}
+	}
+	return cp
+}
+
+func maskFieldValue(f *schema.Field, v any) any {
+	if f != nil && getFieldPolicy(f).noCache {
+		return nil
+	}
+	return v
+}
+
+func immutableFieldError(f *schema.Field) error {
+	return fmt.Errorf("%w: %s", ErrImmutableField, f.Name)
+}
@@ -0,0 +1,104 @@
+package gormup
+
+import (
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+type policyDoc struct {
+	ID        uint64 `gorm:"primaryKey"`
+	Name      string
+	Note      string `gormup:"-"`
+	UpdatedBy string `gormup:"always"`
+	Owner     string `gormup:"immutable"`
+	Token     string `gormup:"nocache"`
+}
+
+func TestFieldPolicies(t *testing.T) {
+	cases := []struct {
+		name   string
+		change func(d *policyDoc)
+		sql    string
+		err    error
+	}{
+		{
+			name:   "ignored only",
+			change: func(d *policyDoc) { d.Note = "n2" },
+		},
+		{
+			name:   "ignored and always ride along",
+			change: func(d *policyDoc) { d.Name = "b" },
+			sql:    "UPDATE `policy_docs` SET `name`=?,`note`=?,`updated_by`=? WHERE `id` = ?",
+		},
+		{
+			name:   "immutable",
+			change: func(d *policyDoc) { d.Name, d.Owner = "b", "mallory" },
+			err:    ErrImmutableField,
+		},
+		{
+			name:   "nocache changed",
+			change: func(d *policyDoc) { d.Token = "t2" },
+			sql:    "UPDATE `policy_docs` SET `token`=?,`note`=?,`updated_by`=? WHERE `id` = ?",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := openTestDB(t, Config{})
+			d := &policyDoc{ID: 1, Name: "a", Note: "n", UpdatedBy: "u", Owner: "o", Token: "t"}
+			seedEntity(t, db, d)
+
+			tt.change(d)
+			err := db.Save(d).Error
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Save() = %v; want %v", err, tt.err)
+			}
+			q := fake.take()
+			switch {
+			case tt.sql == "" && len(q) != 0:
+				t.Errorf("queries = %v; want none", q)
+			case tt.sql != "" && (len(q) != 1 || q[0].SQL != tt.sql):
+				t.Errorf("queries = %v; want %q", q, tt.sql)
+			}
+		})
+	}
+}
+
+func TestNoCacheFieldsStayOutOfStore(t *testing.T) {
+	db, fake := openTestDB(t, Config{})
+	columns := []string{"id", "name", "note", "updated_by", "owner", "token"}
+	fake.rows(columns, []driver.Value{int64(1), "a", "n", "u", "o", "secret"})
+
+	var d policyDoc
+	if err := db.Find(&d, "id = ?", 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	if d.Token != "secret" {
+		t.Fatalf("token = %q; want the loaded value", d.Token)
+	}
+
+	p, _ := getPlugin(db)
+	ent, err := p.lookupEntity(db, &d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token := ent.Model().(*policyDoc).Token; token != "" {
+		t.Errorf("stored token = %q; want it dropped", token)
+	}
+	if _, ok := ent.fields["token"].(digest); !ok {
+		t.Errorf("token snapshot = %#v; want a digest", ent.fields["token"])
+	}
+
+	// из кеша такую модель не отдаем: поле пришлось бы вернуть пустым
+	fake.take()
+	fake.rows(columns, []driver.Value{int64(1), "a", "n", "u", "o", "secret"})
+	var again policyDoc
+	if err := db.Session(&gorm.Session{}).Find(&again, "id = ?", 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n := fake.count("SELECT"); n != 1 || again.Token != "secret" {
+		t.Errorf("select count = %d, token = %q; want a query with the secret", n, again.Token)
+	}
+}
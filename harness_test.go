@@ -0,0 +1,193 @@
+package gormup
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/utils/tests"
+)
+
+// fakeDB — тестовая БД: запоминает запросы и отдает заготовленные строки
+type fakeDB struct {
+	sync.Mutex
+
+	results  []*fakeRows
+	affected int64
+	log      []fakeQuery
+}
+
+type fakeQuery struct {
+	SQL  string
+	Args []driver.Value
+}
+
+// rows ставит в очередь ответ на следующий SELECT
+func (f *fakeDB) rows(columns []string, rows ...[]driver.Value) {
+	f.Lock()
+	defer f.Unlock()
+
+	f.results = append(f.results, &fakeRows{columns: columns, rows: rows})
+}
+
+// take возвращает запросы с прошлого вызова
+func (f *fakeDB) take() []fakeQuery {
+	f.Lock()
+	defer f.Unlock()
+
+	log := f.log
+	f.log = nil
+	return log
+}
+
+// count считает запросы, начинающиеся с prefix
+func (f *fakeDB) count(prefix string) (n int) {
+	for _, q := range f.take() {
+		if strings.HasPrefix(q.SQL, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+func (f *fakeDB) add(query string, args []driver.Value) {
+	f.Lock()
+	defer f.Unlock()
+
+	f.log = append(f.log, fakeQuery{SQL: query, Args: args})
+}
+
+func (f *fakeDB) next() *fakeRows {
+	f.Lock()
+	defer f.Unlock()
+
+	if len(f.results) == 0 {
+		return &fakeRows{}
+	}
+	r := f.results[0]
+	f.results = f.results[1:]
+	return r
+}
+
+var (
+	fakeRegisterOnce sync.Once
+	fakeDBs          sync.Map
+)
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	v, _ := fakeDBs.Load(name)
+	return &fakeConn{db: v.(*fakeDB)}, nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{db: c.db, query: query}, nil
+}
+
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return c, nil }
+func (c *fakeConn) Commit() error             { return nil }
+func (c *fakeConn) Rollback() error           { return nil }
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.db.add(s.query, args)
+	s.db.Lock()
+	defer s.db.Unlock()
+	return fakeResult(s.db.affected), nil
+}
+
+type fakeResult int64
+
+func (r fakeResult) LastInsertId() (int64, error) { return 0, nil }
+func (r fakeResult) RowsAffected() (int64, error) { return int64(r), nil }
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.db.add(s.query, args)
+	r := s.db.next()
+	return &fakeRows{columns: r.columns, rows: r.rows}, nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+	i       int
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.i >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.i])
+	r.i++
+	return nil
+}
+
+// openTestDB регистрирует плагин поверх fakeDB; стор живет до конца теста
+func openTestDB(t *testing.T, cfg Config) (*gorm.DB, *fakeDB) {
+	t.Helper()
+	fakeRegisterOnce.Do(func() { sql.Register("gormup_fake", fakeDriver{}) })
+
+	fake := &fakeDB{affected: 1}
+	fakeDBs.Store(t.Name(), fake)
+	t.Cleanup(func() { fakeDBs.Delete(t.Name()) })
+
+	sqlDB, err := sql.Open("gormup_fake", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open(tests.DummyDialector{}, &gorm.Config{ConnPool: sqlDB, Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	Register(db, cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return db.WithContext(ctx), fake
+}
+
+// seedEntity кладет в стор снимок копии модели, как после чтения из БД
+func seedEntity(t *testing.T, db *gorm.DB, model any) {
+	t.Helper()
+	p, err := getPlugin(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		t.Fatal(err)
+	}
+	cp := reflect.New(reflect.TypeOf(model).Elem()).Elem()
+	cp.Set(reflect.ValueOf(model).Elem())
+
+	ctx := db.Statement.Context
+	ent := createEntity(ctx, entityTable{name: stmt.Schema.Table}, stmt.Schema, nil, cp)
+	if ent == nil {
+		t.Fatal("entity is not created")
+	}
+	ent.comparators = p.config.Comparators
+	p.entities.Set(ctx, ent.Sync(ctx))
+}
@@ -0,0 +1,141 @@
+package gormup
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type jsonbOp struct {
+	path   []string
+	value  any
+	old    any
+	add    bool
+	remove bool
+}
+
+func (p *plugin) patchJSONB(db *gorm.DB) bool {
+	if db.Dialector.Name() != "postgres" {
+		return false
+	}
+	if p.config.PatchJSONB {
+		return true
+	}
+	return p.getBool(db, patchJSONBKey, false)
+}
+
+// applyJSONBPatch заменяет полную перезапись jsonb-колонок выражениями,
+// которые трогают только изменившиеся ключи документа.
+func (p *plugin) applyJSONBPatch(db *gorm.DB, set clause.Set) clause.Set {
+	if !p.patchJSONB(db) {
+		return set
+	}
+	ent := p.getEntity(db)
+	if ent == nil {
+		return set
+	}
+
+	ctx := db.Statement.Context
+	out := make(clause.Set, len(set))
+	for i, v := range set {
+		out[i] = v
+
+		f, ok := ent.schema.FieldsByDBName[v.Column.Name]
+		if !ok || f.DataType != "jsonb" || !isSupportForUpdate(v.Value) || !ent.IsKnown(f.DBName) {
+			continue
+		}
+
+		var oldDoc, newDoc map[string]any
+		if unmarshalJSON(toJSON(ent.fields[f.DBName]), &oldDoc) != nil || oldDoc == nil {
+			continue
+		}
+		newVal := toColumnValue(normalizeValue(ctx, f, ent.reflectValue, v.Value))
+		if unmarshalJSON(toJSON(newVal), &newDoc) != nil || newDoc == nil {
+			continue
+		}
+
+		ops := diffJSONBObject(nil, oldDoc, newDoc)
+		if len(ops) == 0 {
+			continue
+		}
+		out[i] = clause.Assignment{Column: v.Column, Value: buildJSONBPatch(f.DBName, ops)}
+	}
+	return out
+}
+
+func diffJSONBObject(prefix []string, oldDoc, newDoc map[string]any) (ops []jsonbOp) {
+	keys := make([]string, 0, len(oldDoc)+len(newDoc))
+	for k := range oldDoc {
+		keys = append(keys, k)
+	}
+	for k := range newDoc {
+		if _, ok := oldDoc[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+
+	for _, k := range keys {
+		path := append(slices.Clone(prefix), k)
+		oldVal, inOld := oldDoc[k]
+		newVal, inNew := newDoc[k]
+		switch {
+		case !inNew:
+			ops = append(ops, jsonbOp{path: path, old: oldVal, remove: true})
+		case !inOld:
+			ops = append(ops, jsonbOp{path: path, value: newVal, add: true})
+		default:
+			oldObj, oldIsObj := oldVal.(map[string]any)
+			newObj, newIsObj := newVal.(map[string]any)
+			if oldIsObj && newIsObj {
+				ops = append(ops, diffJSONBObject(path, oldObj, newObj)...)
+			} else if !isEqualJSON(oldVal, newVal) {
+				ops = append(ops, jsonbOp{path: path, value: newVal, old: oldVal})
+			}
+		}
+	}
+	return ops
+}
+
+func buildJSONBPatch(column string, ops []jsonbOp) clause.Expr {
+	sql := "?"
+	vars := []any{clause.Column{Name: column}}
+
+	top := map[string]any{}
+	for _, op := range ops {
+		switch {
+		case op.remove && len(op.path) == 1:
+			sql = "(" + sql + " - ?::text)"
+			vars = append(vars, op.path[0])
+		case op.remove:
+			sql = "(" + sql + " #- ?::text[])"
+			vars = append(vars, toPgTextArray(op.path))
+		case len(op.path) == 1:
+			top[op.path[0]] = op.value
+		default:
+			value, _ := json.Marshal(op.value)
+			sql = "jsonb_set(" + sql + ", ?::text[], ?::jsonb, true)"
+			vars = append(vars, toPgTextArray(op.path), string(value))
+		}
+	}
+	if len(top) > 0 {
+		value, _ := json.Marshal(top)
+		sql = "(" + sql + " || ?::jsonb)"
+		vars = append(vars, string(value))
+	}
+
+	return clause.Expr{SQL: sql, Vars: vars, WithoutParentheses: true}
+}
+
+func toPgTextArray(path []string) string {
+	elems := make([]string, len(path))
+	for i, p := range path {
+		p = strings.ReplaceAll(p, `\`, `\\`)
+		p = strings.ReplaceAll(p, `"`, `\"`)
+		elems[i] = `"` + p + `"`
+	}
+	return "{" + strings.Join(elems, ",") + "}"
+}
@@ -0,0 +1,155 @@
+package gormup
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"gorm.io/gorm/clause"
+)
+
+func TestDiffJSONBObject(t *testing.T) {
+	cases := []struct {
+		name     string
+		old, new map[string]any
+		want     []jsonbOp
+	}{
+		{
+			name: "equal",
+			old:  map[string]any{"a": 1.0, "b": map[string]any{"c": "x"}},
+			new:  map[string]any{"a": 1.0, "b": map[string]any{"c": "x"}},
+		},
+		{
+			name: "top level",
+			old:  map[string]any{"a": 1.0, "b": 2.0},
+			new:  map[string]any{"a": 3.0, "c": 4.0},
+			want: []jsonbOp{
+				{path: []string{"a"}, value: 3.0, old: 1.0},
+				{path: []string{"b"}, old: 2.0, remove: true},
+				{path: []string{"c"}, value: 4.0, add: true},
+			},
+		},
+		{
+			name: "nested",
+			old:  map[string]any{"a": map[string]any{"b": 1.0, "c": 2.0}},
+			new:  map[string]any{"a": map[string]any{"b": 5.0}},
+			want: []jsonbOp{
+				{path: []string{"a", "b"}, value: 5.0, old: 1.0},
+				{path: []string{"a", "c"}, old: 2.0, remove: true},
+			},
+		},
+		{
+			name: "object replaced by scalar",
+			old:  map[string]any{"a": map[string]any{"b": 1.0}},
+			new:  map[string]any{"a": "x"},
+			want: []jsonbOp{
+				{path: []string{"a"}, value: "x", old: map[string]any{"b": 1.0}},
+			},
+		},
+		{
+			name: "arrays are replaced whole",
+			old:  map[string]any{"a": []any{1.0, 2.0}},
+			new:  map[string]any{"a": []any{1.0}},
+			want: []jsonbOp{
+				{path: []string{"a"}, value: []any{1.0}, old: []any{1.0, 2.0}},
+			},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diffJSONBObject(nil, tt.old, tt.new)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffJSONBObject() = %+v; want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildJSONBPatch(t *testing.T) {
+	column := clause.Column{Name: "meta"}
+
+	cases := []struct {
+		name string
+		ops  []jsonbOp
+		sql  string
+		vars []any
+	}{
+		{
+			name: "top level keys are merged",
+			ops: []jsonbOp{
+				{path: []string{"a"}, value: 1},
+				{path: []string{"b"}, value: "x", add: true},
+			},
+			sql:  "(? || ?::jsonb)",
+			vars: []any{column, `{"a":1,"b":"x"}`},
+		},
+		{
+			name: "remove",
+			ops: []jsonbOp{
+				{path: []string{"a"}, remove: true},
+				{path: []string{"b", "c"}, remove: true},
+			},
+			sql:  "((? - ?::text) #- ?::text[])",
+			vars: []any{column, "a", `{"b","c"}`},
+		},
+		{
+			name: "nested set",
+			ops: []jsonbOp{
+				{path: []string{"a", `q"t`}, value: map[string]any{"x": true}},
+			},
+			sql:  "jsonb_set(?, ?::text[], ?::jsonb, true)",
+			vars: []any{column, `{"a","q\"t"}`, `{"x":true}`},
+		},
+		{
+			name: "mixed",
+			ops: []jsonbOp{
+				{path: []string{"a", "b"}, value: 2},
+				{path: []string{"c"}, remove: true},
+				{path: []string{"d"}, value: nil},
+			},
+			sql:  "((jsonb_set(?, ?::text[], ?::jsonb, true) - ?::text) || ?::jsonb)",
+			vars: []any{column, `{"a","b"}`, "2", "c", `{"d":null}`},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got := buildJSONBPatch("meta", tt.ops)
+			if got.SQL != tt.sql {
+				t.Errorf("sql = %q; want %q", got.SQL, tt.sql)
+			}
+			if !reflect.DeepEqual(got.Vars, tt.vars) {
+				t.Errorf("vars = %#v; want %#v", got.Vars, tt.vars)
+			}
+		})
+	}
+}
+
+func TestJSONBigNumbers(t *testing.T) {
+	// 2^53+1 и 2^53 в float64 неразличимы
+	oldJSON, newJSON := `{"n":9007199254740992,"f":1.0}`, `{"n":9007199254740993,"f":1}`
+
+	if JSONComparator(oldJSON, newJSON) {
+		t.Errorf("JSONComparator(%s, %s) = true; want false", oldJSON, newJSON)
+	}
+	if !JSONComparator(`{"f":1.0}`, `{"f":1}`) {
+		t.Error("JSONComparator() compares numbers by text; want by value")
+	}
+
+	var oldDoc, newDoc map[string]any
+	if err := unmarshalJSON([]byte(oldJSON), &oldDoc); err != nil {
+		t.Fatal(err)
+	}
+	if err := unmarshalJSON([]byte(newJSON), &newDoc); err != nil {
+		t.Fatal(err)
+	}
+	ops := diffJSONBObject(nil, oldDoc, newDoc)
+	want := []jsonbOp{{path: []string{"n"}, value: json.Number("9007199254740993"), old: json.Number("9007199254740992")}}
+	if !reflect.DeepEqual(ops, want) {
+		t.Fatalf("diffJSONBObject() = %+v; want %+v", ops, want)
+	}
+
+	expr := buildJSONBPatch("meta", ops)
+	if got := expr.Vars[len(expr.Vars)-1]; got != `{"n":9007199254740993}` {
+		t.Errorf("patch value = %v; want %s", got, `{"n":9007199254740993}`)
+	}
+}
@@ -0,0 +1,71 @@
+package gormup
+
+import (
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+type ChangeListener func(tx *gorm.DB, key string, change Change) error
+
+type listenerKey struct {
+	table  string
+	column string
+}
+
+var listeners = struct {
+	sync.RWMutex
+	before map[listenerKey][]ChangeListener
+	after  map[listenerKey][]ChangeListener
+}{
+	before: map[listenerKey][]ChangeListener{},
+	after:  map[listenerKey][]ChangeListener{},
+}
+
+// OnChange вызывается до записи, если колонка действительно меняется
+// относительно известного снимка; ошибка отменяет обновление.
+// В DryRun не вызывается.
+func OnChange(table, column string, fn ChangeListener) {
+	listeners.Lock()
+	defer listeners.Unlock()
+
+	key := listenerKey{table: table, column: column}
+	listeners.before[key] = append(listeners.before[key], fn)
+}
+
+// OnChanged вызывается после успешной записи внутри той же транзакции.
+func OnChanged(table, column string, fn ChangeListener) {
+	listeners.Lock()
+	defer listeners.Unlock()
+
+	key := listenerKey{table: table, column: column}
+	listeners.after[key] = append(listeners.after[key], fn)
+}
+
+func (p *plugin) notify(db *gorm.DB, registry map[listenerKey][]ChangeListener, cs *changeSet) error {
+	if cs == nil {
+		return nil
+	}
+
+	listeners.RLock()
+	defer listeners.RUnlock()
+
+	tables := []string{cs.table}
+	if cs.schema != nil && cs.schema.Table != cs.table {
+		// шард слушают и по имени основной таблицы
+		tables = append(tables, cs.schema.Table)
+	}
+	for _, change := range cs.changes {
+		if !change.changed {
+			continue
+		}
+		for _, table := range tables {
+			for _, fn := range registry[listenerKey{table: table, column: change.Column}] {
+				if err := fn(db, cs.key, change); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
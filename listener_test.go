@@ -0,0 +1,108 @@
+package gormup
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// listenedDoc нужен только этому тесту: реестр слушателей глобальный
+type listenedDoc struct {
+	ID     uint64 `gorm:"primaryKey"`
+	Name   string
+	Number int64
+}
+
+var errForbiddenName = errors.New("forbidden name")
+
+type listenerLog struct {
+	sync.Mutex
+	calls []string
+}
+
+func (l *listenerLog) add(format string, args ...any) {
+	l.Lock()
+	defer l.Unlock()
+	l.calls = append(l.calls, fmt.Sprintf(format, args...))
+}
+
+func (l *listenerLog) take() []string {
+	l.Lock()
+	defer l.Unlock()
+	calls := l.calls
+	l.calls = nil
+	return calls
+}
+
+func TestChangeListeners(t *testing.T) {
+	log := &listenerLog{}
+	OnChange("listened_docs", "name", func(tx *gorm.DB, key string, c Change) error {
+		if c.New == "forbidden" {
+			return errForbiddenName
+		}
+		log.add("before %s %v->%v", key, c.Old, c.New)
+		return nil
+	})
+	OnChanged("listened_docs", "name", func(tx *gorm.DB, key string, c Change) error {
+		log.add("after %s %v->%v", key, c.Old, c.New)
+		return nil
+	})
+	OnChanged("listened_docs", "number", func(tx *gorm.DB, key string, c Change) error {
+		log.add("number %s", key)
+		return nil
+	})
+
+	db, fake := openTestDB(t, Config{})
+	d := &listenedDoc{ID: 1, Name: "a", Number: 1}
+	seedEntity(t, db, d)
+
+	d.Name = "b"
+	if err := db.Save(d).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got, want := log.take(), []string{"before 1 a->b", "after 1 a->b"}; !slices.Equal(got, want) {
+		t.Errorf("calls = %v; want %v", got, want)
+	}
+	fake.take()
+
+	d.Name = "c"
+	if err := DryRun(db).Save(d).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := log.take(); len(got) != 0 {
+		t.Errorf("calls in dry run = %v; want none", got)
+	}
+
+	d.Name = "forbidden"
+	if err := db.Save(d).Error; !errors.Is(err, errForbiddenName) {
+		t.Fatalf("Save() = %v; want the listener error", err)
+	}
+	if n := fake.count("UPDATE"); n != 0 {
+		t.Errorf("updates = %d; want the write cancelled", n)
+	}
+	if got := log.take(); len(got) != 0 {
+		t.Errorf("calls = %v; want none", got)
+	}
+
+	// шард слушают и по имени основной таблицы
+	fake.rows([]string{"id", "name", "number"}, []driver.Value{int64(2), "a", int64(1)})
+	var s listenedDoc
+	if err := db.Table("listened_docs_2024").Find(&s, "id = ?", 2).Error; err != nil {
+		t.Fatal(err)
+	}
+	s.Name = "z"
+	if err := db.Table("listened_docs_2024").Save(&s).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got, want := log.take(), []string{"before 2 a->z", "after 2 a->z"}; !slices.Equal(got, want) {
+		t.Errorf("shard calls = %v; want %v", got, want)
+	}
+	if n := fake.count("UPDATE `listened_docs_2024`"); n != 1 {
+		t.Errorf("shard updates = %d; want 1", n)
+	}
+}
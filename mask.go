@@ -0,0 +1,283 @@
+package gormup
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+var ErrUnknownPath = errors.New("unknown path")
+var ErrIncompatibleValue = errors.New("incompatible value")
+
+// ErrReadOnlyPath — путь ведет к первичному ключу или к полю, которое gorm не обновляет
+var ErrReadOnlyPath = errors.New("read-only path")
+
+type PathError struct {
+	Path string
+	Err  error
+}
+
+func (e *PathError) Error() string {
+	return e.Err.Error() + ": " + e.Path
+}
+
+func (e *PathError) Unwrap() error {
+	return e.Err
+}
+
+// ApplyMask копирует из src в model только перечисленные пути (FieldMask вида
+// "name,contact_info.phone") и сохраняет model, отдавая запись редуктору.
+func ApplyMask(db *gorm.DB, model any, src any, paths []string) error {
+	ctx := db.Statement.Context
+
+	dst := newPathResolver(db, model, true)
+	// DTO разбираем по структуре: схема для него может и не строиться
+	from := newPathResolver(db, src, getModelType(dst.root) == getModelType(reflect.ValueOf(src)))
+
+	type assignment struct {
+		path    string
+		value   reflect.Value
+		prepare func(reflect.Value) (func(), bool)
+	}
+	assignments := make([]assignment, 0, len(paths))
+	for _, path := range paths {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+
+		prepare, err := dst.preparer(ctx, path)
+		if err != nil {
+			return &PathError{Path: path, Err: err}
+		}
+		value, ok := from.value(ctx, path)
+		if !ok {
+			return &PathError{Path: path, Err: ErrUnknownPath}
+		}
+		assignments = append(assignments, assignment{path: path, value: value, prepare: prepare})
+	}
+
+	// значения приводим до записи: при ошибке модель остается как была
+	applies := make([]func(), 0, len(assignments))
+	for _, a := range assignments {
+		apply, ok := a.prepare(a.value)
+		if !ok {
+			return &PathError{Path: a.path, Err: ErrIncompatibleValue}
+		}
+		applies = append(applies, apply)
+	}
+	for _, apply := range applies {
+		apply()
+	}
+
+	return db.Save(model).Error
+}
+
+type pathResolver struct {
+	root   reflect.Value
+	schema *schema.Schema
+	namer  schema.Namer
+}
+
+func newPathResolver(db *gorm.DB, v any, withSchema bool) *pathResolver {
+	r := &pathResolver{
+		root:  reflect.ValueOf(v),
+		namer: db.NamingStrategy,
+	}
+	if withSchema {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(v); err == nil {
+			r.schema = stmt.Schema
+		}
+	}
+	return r
+}
+
+func (r *pathResolver) value(ctx context.Context, path string) (reflect.Value, bool) {
+	v, ok := r.resolve(ctx, path, false)
+	if !ok {
+		return reflect.Value{}, false
+	}
+	if v.container.IsValid() {
+		return v.container.MapIndex(v.key), true
+	}
+	return v.value, true
+}
+
+func (r *pathResolver) setter(ctx context.Context, path string) (func(reflect.Value) bool, error) {
+	prepare, err := r.preparer(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return func(src reflect.Value) bool {
+		apply, ok := prepare(src)
+		if ok {
+			apply()
+		}
+		return ok
+	}, nil
+}
+
+// preparer приводит значение к типу пути и возвращает запись отдельно,
+// чтобы несовместимое значение обнаружилось до изменения модели
+func (r *pathResolver) preparer(ctx context.Context, path string) (func(reflect.Value) (func(), bool), error) {
+	v, ok := r.resolve(ctx, path, true)
+	if !ok {
+		return nil, ErrUnknownPath
+	}
+	if f := v.field; f != nil && (f.PrimaryKey || !f.Updatable) {
+		// смена ключа превратит следующий Save в INSERT
+		return nil, ErrReadOnlyPath
+	}
+	if v.container.IsValid() {
+		return func(src reflect.Value) (func(), bool) {
+			el := reflect.New(v.container.Type().Elem()).Elem()
+			if !assignValue(el, src) {
+				return nil, false
+			}
+			return func() { v.container.SetMapIndex(v.key, el) }, true
+		}, nil
+	}
+	if !v.value.CanSet() {
+		return nil, ErrUnknownPath
+	}
+	return func(src reflect.Value) (func(), bool) {
+		el := reflect.New(v.value.Type()).Elem()
+		if !assignValue(el, src) {
+			return nil, false
+		}
+		return func() { v.value.Set(el) }, true
+	}, nil
+}
+
+type resolvedPath struct {
+	value reflect.Value
+	// поле схемы, если путь на него попал
+	field *schema.Field
+
+	// элемент map задаётся через контейнер и ключ
+	container reflect.Value
+	key       reflect.Value
+}
+
+func (r *pathResolver) resolve(ctx context.Context, path string, alloc bool) (resolvedPath, bool) {
+	segments := strings.Split(path, ".")
+
+	// колонки схемы покрывают embeddedPrefix: "doc_type" -> DocType.Type
+	if r.schema != nil && len(segments) == 1 {
+		if f := r.schema.LookUpField(segments[0]); f != nil && f.DBName != "" {
+			if !alloc && !isReachable(r.root, f.StructField.Index) {
+				return resolvedPath{}, true
+			}
+			return resolvedPath{value: f.ReflectValueOf(ctx, r.root), field: f}, true
+		}
+	}
+
+	v := r.root
+	var index []int
+	for i, seg := range segments {
+		v = r.indirect(v, alloc)
+		if !v.IsValid() {
+			// nil-указатель в источнике — значит нулевое значение
+			return resolvedPath{}, !alloc
+		}
+
+		switch v.Kind() {
+		case reflect.Struct:
+			idx, ok := r.findField(v.Type(), seg)
+			if !ok {
+				return resolvedPath{}, false
+			}
+			v = v.FieldByIndex(idx)
+			index = append(index, idx...)
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String || i != len(segments)-1 {
+				return resolvedPath{}, false
+			}
+			if v.IsNil() {
+				if !alloc {
+					return resolvedPath{}, true
+				}
+				if !v.CanSet() {
+					return resolvedPath{}, false
+				}
+				v.Set(reflect.MakeMap(v.Type()))
+			}
+			return resolvedPath{container: v, key: reflect.ValueOf(seg).Convert(v.Type().Key())}, true
+		default:
+			return resolvedPath{}, false
+		}
+	}
+	return resolvedPath{value: v, field: r.fieldByIndex(index)}, true
+}
+
+// fieldByIndex находит поле схемы по пути индексов, в том числе во встроенных структурах
+func (r *pathResolver) fieldByIndex(index []int) *schema.Field {
+	if r.schema == nil {
+		return nil
+	}
+	for _, f := range r.schema.Fields {
+		if slices.Equal(f.StructField.Index, index) {
+			return f
+		}
+	}
+	return nil
+}
+
+func (r *pathResolver) indirect(v reflect.Value, alloc bool) reflect.Value {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			if !alloc || v.Kind() == reflect.Interface || !v.CanSet() {
+				return reflect.Value{}
+			}
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// findField ищет поле структуры по имени Go, имени колонки или json-тегу.
+func (r *pathResolver) findField(t reflect.Type, name string) ([]int, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		if matchFieldName(r.namer, sf, name) {
+			return sf.Index, true
+		}
+	}
+	return nil, false
+}
+
+func matchFieldName(namer schema.Namer, sf reflect.StructField, name string) bool {
+	if strings.EqualFold(sf.Name, name) {
+		return true
+	}
+	if namer != nil && namer.ColumnName("", sf.Name) == name {
+		return true
+	}
+	if jsonName, ok := jsonFieldName(sf); ok && jsonName == name && !sf.Anonymous {
+		return true
+	}
+	return false
+}
+
+func isReachable(v reflect.Value, index []int) bool {
+	for _, i := range index {
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	return true
+}
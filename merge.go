@@ -0,0 +1,163 @@
+package gormup
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"gorm.io/gorm"
+)
+
+type ZeroPolicy int
+
+const (
+	// MergeSkipZero не переносит нулевые значения DTO
+	MergeSkipZero ZeroPolicy = iota
+	// MergeOverwrite переносит все совпавшие поля, включая нулевые
+	MergeOverwrite
+	// MergeNonNilPointers переносит только поля-указатели, отличные от nil
+	MergeNonNilPointers
+)
+
+type MergeOptions struct {
+	Zero ZeroPolicy
+}
+
+// Merge переносит совпавшие по имени поля dto в model и возвращает изменения
+// относительно снимка. Ничего не пишет: дальше обычный Save с редукцией.
+func Merge(db *gorm.DB, model any, dto any, opts MergeOptions) ([]Change, error) {
+	p, err := getPlugin(db)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, err
+	}
+
+	ctx := db.Statement.Context
+	base, err := p.lookupEntity(db, model)
+	if err != nil {
+		// не отслеживается: сравниваем со снимком до слияния
+		base = (&entity{
+			schema:       stmt.Schema,
+			reflectValue: reflect.Indirect(reflect.ValueOf(model)),
+			comparators:  p.config.Comparators,
+		}).Sync(ctx)
+	}
+
+	dst := newPathResolver(db, model, true)
+	m := &merger{opts: opts}
+	if err := m.mergeStruct(ctx, dst, reflect.ValueOf(dto), ""); err != nil {
+		return nil, err
+	}
+
+	current := &entity{
+		schema:       stmt.Schema,
+		reflectValue: reflect.Indirect(reflect.ValueOf(model)),
+	}
+
+	var changes []Change
+	for _, f := range current.trackedFields() {
+		value := current.fieldValue(ctx, f)
+		if base.IsKnown(f.DBName) && p.config.Comparators.Equal(f, value, base.fields[f.DBName]) {
+			continue
+		}
+		change := Change{Column: f.DBName, New: maskFieldValue(f, value)}
+		if base.IsKnown(f.DBName) {
+			change.Old = maskFieldValue(f, base.fields[f.DBName])
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+type merger struct {
+	opts MergeOptions
+}
+
+func (m *merger) mergeStruct(ctx context.Context, dst *pathResolver, src reflect.Value, prefix string) error {
+	for src.Kind() == reflect.Ptr || src.Kind() == reflect.Interface {
+		if src.IsNil() {
+			return nil
+		}
+		src = src.Elem()
+	}
+	if src.Kind() != reflect.Struct {
+		return nil
+	}
+
+	t := src.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		value := src.Field(i)
+
+		// встроенные структуры DTO раскрываем на тот же уровень
+		if sf.Anonymous && reflect.Indirect(value).Kind() == reflect.Struct {
+			if err := m.mergeStruct(ctx, dst, value, prefix); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !m.accept(value) {
+			continue
+		}
+
+		path, set, ok := m.lookup(ctx, dst, sf, prefix)
+		if !ok {
+			continue
+		}
+		if set(value) {
+			continue
+		}
+
+		// несовместимые вложенные структуры сливаем поле за полем
+		if reflect.Indirect(value).Kind() == reflect.Struct {
+			if err := m.mergeStruct(ctx, dst, value, path+"."); err != nil {
+				return err
+			}
+			continue
+		}
+		return &PathError{Path: path, Err: ErrIncompatibleValue}
+	}
+	return nil
+}
+
+func (m *merger) lookup(
+	ctx context.Context,
+	dst *pathResolver,
+	sf reflect.StructField,
+	prefix string,
+) (string, func(reflect.Value) bool, bool) {
+	names := []string{sf.Name}
+	if name, ok := jsonFieldName(sf); ok {
+		names = append(names, name)
+	}
+	for _, name := range names {
+		set, err := dst.setter(ctx, prefix+name)
+		if errors.Is(err, ErrReadOnlyPath) {
+			// ключ и необновляемые поля DTO в модель не переносим
+			return "", nil, false
+		}
+		if err == nil {
+			return prefix + name, set, true
+		}
+	}
+	return "", nil, false
+}
+
+func (m *merger) accept(v reflect.Value) bool {
+	switch m.opts.Zero {
+	case MergeOverwrite:
+		return true
+	case MergeNonNilPointers:
+		return v.Kind() == reflect.Ptr && !v.IsNil()
+	default:
+		return !v.IsZero()
+	}
+}
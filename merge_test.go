@@ -0,0 +1,191 @@
+package gormup
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestMergeSkipsReadOnlyFields(t *testing.T) {
+	type dto struct {
+		ID   uint64
+		Name string
+	}
+
+	db, fake := openTestDB(t, Config{})
+	d := &testDoc{ID: 1, Name: "a", Number: 10}
+	seedEntity(t, db, d)
+
+	changes, err := Merge(db, d, dto{ID: 0, Name: "b"}, MergeOptions{Zero: MergeOverwrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.ID != 1 {
+		t.Fatalf("primary key overwritten: %+v", d)
+	}
+	if len(changes) != 1 || changes[0].Column != "name" || changes[0].Old != "a" || changes[0].New != "b" {
+		t.Errorf("changes = %+v", changes)
+	}
+
+	if err := db.Save(d).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n := fake.count("INSERT"); n != 0 {
+		t.Errorf("Save after Merge inserted %d rows", n)
+	}
+}
+
+func TestApplyMaskRejectsReadOnlyPaths(t *testing.T) {
+	type embedded struct {
+		gorm.Model
+		Name      string
+		CreatedBy string `gorm:"<-:create"`
+	}
+
+	db, _ := openTestDB(t, Config{})
+
+	cases := []struct {
+		name  string
+		model any
+		src   any
+		path  string
+	}{
+		{name: "primary key", model: &testDoc{ID: 1}, src: testDoc{ID: 2}, path: "id"},
+		{name: "go name", model: &testDoc{ID: 1}, src: testDoc{ID: 2}, path: "ID"},
+		{name: "embedded primary key", model: &embedded{Model: gorm.Model{ID: 1}}, src: embedded{}, path: "Model.ID"},
+		{name: "create only", model: &embedded{Model: gorm.Model{ID: 1}}, src: embedded{CreatedBy: "x"}, path: "created_by"},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ApplyMask(db, tt.model, tt.src, []string{tt.path})
+			var pathErr *PathError
+			if !errors.As(err, &pathErr) || !errors.Is(err, ErrReadOnlyPath) || pathErr.Path != tt.path {
+				t.Errorf("ApplyMask(%q) = %v; want ErrReadOnlyPath", tt.path, err)
+			}
+		})
+	}
+}
+
+type maskedDoc struct {
+	ID      uint64 `gorm:"primaryKey"`
+	Name    string
+	Number  int64
+	Contact patchContact      `gorm:"embedded;embeddedPrefix:contact_" json:"contact_info"`
+	Labels  map[string]string `gorm:"serializer:json"`
+}
+
+func TestApplyMask(t *testing.T) {
+	type contactDTO struct {
+		Phone *string
+	}
+	type dto struct {
+		Name    string
+		Number  string
+		Contact contactDTO `json:"contact_info"`
+		Labels  map[string]string
+	}
+	phone := "2"
+	src := dto{Name: "b", Number: "x", Contact: contactDTO{Phone: &phone}, Labels: map[string]string{"env": "prod"}}
+
+	cases := []struct {
+		name  string
+		paths []string
+		sql   string
+		err   error
+	}{
+		{name: "column", paths: []string{"name"}, sql: "UPDATE `masked_docs` SET `name`=? WHERE `id` = ?"},
+		{name: "nested by json name", paths: []string{"contact_info.phone"}, sql: "UPDATE `masked_docs` SET `contact_phone`=? WHERE `id` = ?"},
+		{name: "map key", paths: []string{" labels.env ", ""}, sql: "UPDATE `masked_docs` SET `labels`=? WHERE `id` = ?"},
+		{name: "unchanged", paths: []string{"labels.team"}},
+		{name: "unknown", paths: []string{"name", "missing"}, err: ErrUnknownPath},
+		{name: "incompatible", paths: []string{"name", "number"}, err: ErrIncompatibleValue},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := openTestDB(t, Config{})
+			d := &maskedDoc{ID: 1, Name: "a", Number: 1, Contact: patchContact{Phone: "1"}, Labels: map[string]string{"team": ""}}
+			seedEntity(t, db, d)
+
+			err := ApplyMask(db, d, src, tt.paths)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("ApplyMask() = %v; want %v", err, tt.err)
+			}
+			if tt.err != nil && d.Name != "a" {
+				t.Errorf("model changed on error: %+v", d)
+			}
+			q := fake.take()
+			switch {
+			case tt.sql == "" && len(q) != 0:
+				t.Errorf("queries = %v; want none", q)
+			case tt.sql != "" && (len(q) != 1 || q[0].SQL != tt.sql):
+				t.Errorf("queries = %v; want %q", q, tt.sql)
+			}
+		})
+	}
+}
+
+func TestMergeZeroPolicies(t *testing.T) {
+	type dto struct {
+		Name   string `json:"name"`
+		Number *int64 `json:"number"`
+	}
+	zero := int64(0)
+
+	cases := []struct {
+		name    string
+		zero    ZeroPolicy
+		dto     dto
+		want    testDoc
+		columns []string
+	}{
+		{name: "skip zero", zero: MergeSkipZero, dto: dto{Number: &zero}, want: testDoc{ID: 1, Name: "a", Number: 0}, columns: []string{"number"}},
+		{name: "skip zero keeps model", zero: MergeSkipZero, dto: dto{}, want: testDoc{ID: 1, Name: "a", Number: 10}},
+		{name: "overwrite", zero: MergeOverwrite, dto: dto{}, want: testDoc{ID: 1, Name: "", Number: 0}, columns: []string{"name", "number"}},
+		{name: "non-nil pointers", zero: MergeNonNilPointers, dto: dto{Name: "b", Number: &zero}, want: testDoc{ID: 1, Name: "a", Number: 0}, columns: []string{"number"}},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, Config{})
+			d := &testDoc{ID: 1, Name: "a", Number: 10}
+			seedEntity(t, db, d)
+
+			changes, err := Merge(db, d, tt.dto, MergeOptions{Zero: tt.zero})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *d != tt.want {
+				t.Errorf("model = %+v; want %+v", *d, tt.want)
+			}
+			var columns []string
+			for _, c := range changes {
+				columns = append(columns, c.Column)
+			}
+			if !reflect.DeepEqual(columns, tt.columns) {
+				t.Errorf("changed columns = %v; want %v", columns, tt.columns)
+			}
+		})
+	}
+}
+
+func TestMergeNotTracked(t *testing.T) {
+	db, fake := openTestDB(t, Config{})
+	d := &testDoc{ID: 1, Name: "a", Number: 10}
+
+	changes, err := Merge(db, d, map[string]any{"ignored": true}, MergeOptions{})
+	if err != nil || len(changes) != 0 {
+		t.Fatalf("Merge(map) = %v, %v; want no changes", changes, err)
+	}
+	changes, err = Merge(db, d, struct{ Name string }{Name: "b"}, MergeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// без снимка изменения считаются от состояния модели до слияния
+	if len(changes) != 1 || changes[0].Column != "name" || changes[0].Old != "a" || changes[0].New != "b" {
+		t.Errorf("changes = %+v", changes)
+	}
+	if q := fake.take(); len(q) != 0 {
+		t.Errorf("Merge ran queries: %v", q)
+	}
+}
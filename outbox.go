@@ -0,0 +1,146 @@
+package gormup
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/shockerli/cvt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type OutboxEvent struct {
+	ID          uint64
+	EntityType  string
+	EntityKey   string
+	Action      string
+	Changes     string
+	Version     int64
+	CreatedAt   time.Time
+	PublishedAt *time.Time
+}
+
+type Outbox struct {
+	table string
+}
+
+func NewOutbox(table string) *Outbox {
+	return &Outbox{
+		table: table,
+	}
+}
+
+func (o *Outbox) Insert(tx *gorm.DB, ev OutboxEvent) error {
+	if ev.CreatedAt.IsZero() {
+		ev.CreatedAt = tx.NowFunc()
+	}
+	return tx.Session(&gorm.Session{NewDB: true, SkipHooks: true}).
+		Table(o.table).
+		Create(map[string]any{
+			"entity_type": ev.EntityType,
+			"entity_key":  ev.EntityKey,
+			"action":      ev.Action,
+			"changes":     ev.Changes,
+			"version":     ev.Version,
+			"created_at":  ev.CreatedAt,
+		}).
+		Error
+}
+
+type Relay struct {
+	db    *gorm.DB
+	table string
+}
+
+func NewRelay(db *gorm.DB, table string) *Relay {
+	return &Relay{
+		db:    db,
+		table: table,
+	}
+}
+
+func (r *Relay) Fetch(ctx context.Context, limit int) (events []OutboxEvent, err error) {
+	err = r.fetch(r.session(r.db, ctx), limit).Find(&events).Error
+	return events, err
+}
+
+func (r *Relay) MarkPublished(ctx context.Context, ids ...uint64) error {
+	return r.markPublished(r.session(r.db, ctx), ids...)
+}
+
+// Process забирает неопубликованные события под блокировкой и помечает их
+// опубликованными, если fn завершилась без ошибки.
+func (r *Relay) Process(ctx context.Context, limit int, fn func([]OutboxEvent) error) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var events []OutboxEvent
+		query := r.fetch(r.session(tx, ctx), limit)
+		switch tx.Dialector.Name() {
+		case "postgres", "mysql":
+			query = query.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+		}
+		if err := query.Find(&events).Error; err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+
+		if err := fn(events); err != nil {
+			return err
+		}
+
+		ids := make([]uint64, len(events))
+		for i, ev := range events {
+			ids[i] = ev.ID
+		}
+		return r.markPublished(r.session(tx, ctx), ids...)
+	})
+}
+
+func (r *Relay) session(db *gorm.DB, ctx context.Context) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true, SkipHooks: true, Context: ctx}).Table(r.table)
+}
+
+func (r *Relay) fetch(db *gorm.DB, limit int) *gorm.DB {
+	return db.Where("published_at IS NULL").Order("id").Limit(limit)
+}
+
+func (r *Relay) markPublished(db *gorm.DB, ids ...uint64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return db.Where("id IN ?", ids).Update("published_at", db.NowFunc()).Error
+}
+
+func (p *plugin) publish(db *gorm.DB, action AuditAction, cs *changeSet) {
+	if p.config.Outbox == nil || cs == nil {
+		return
+	}
+
+	changes, err := json.Marshal(actualChanges(cs.changes))
+	if db.AddError(err) != nil {
+		return
+	}
+
+	ev := OutboxEvent{
+		EntityType: cs.table,
+		EntityKey:  cs.key,
+		Action:     string(action),
+		Changes:    string(changes),
+	}
+	if f := p.getVersionField(cs.schema); f != nil {
+		for _, c := range cs.changes {
+			if c.Column != f.DBName {
+				continue
+			}
+			if action == AuditDelete {
+				ev.Version = cvt.Int64(c.Old)
+			} else {
+				ev.Version = cvt.Int64(c.New)
+			}
+		}
+	}
+
+	_ = db.AddError(p.config.Outbox.Insert(db, ev))
+}
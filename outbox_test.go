@@ -0,0 +1,113 @@
+package gormup
+
+import (
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// insertValues сопоставляет колонки INSERT с аргументами запроса
+func insertValues(q fakeQuery) map[string]driver.Value {
+	m := regexp.MustCompile(`\(([^)]*)\) VALUES`).FindStringSubmatch(q.SQL)
+	if m == nil {
+		return nil
+	}
+	out := map[string]driver.Value{}
+	for i, col := range strings.Split(m[1], ",") {
+		if i < len(q.Args) {
+			out[strings.Trim(col, "` ")] = q.Args[i]
+		}
+	}
+	return out
+}
+
+func TestOutboxEvents(t *testing.T) {
+	db, fake := openTestDB(t, Config{Outbox: NewOutbox("outbox")})
+	d := &versionedDoc{ID: 1, Name: "a", Number: 1, Version: 3}
+	seedEntity(t, db, d)
+
+	d.Name = "b"
+	if err := db.Save(d).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete(d).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var events []map[string]driver.Value
+	for _, q := range fake.take() {
+		if strings.HasPrefix(q.SQL, "INSERT INTO `outbox`") {
+			ev := insertValues(q)
+			delete(ev, "created_at")
+			events = append(events, ev)
+		}
+	}
+	want := []map[string]driver.Value{
+		{
+			"entity_type": "versioned_docs", "entity_key": "1", "action": "update",
+			"changes": `[{"column":"name","old":"a","new":"b"},{"column":"version","old":3,"new":4}]`, "version": int64(4),
+		},
+		{
+			"entity_type": "versioned_docs", "entity_key": "1", "action": "delete",
+			"changes": `[{"column":"name","old":"b","new":null},{"column":"number","old":1,"new":null},{"column":"version","old":4,"new":null}]`, "version": int64(4),
+		},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %v\nwant %v", events, want)
+	}
+}
+
+func TestRelayProcess(t *testing.T) {
+	cases := []struct {
+		name   string
+		err    error
+		marked bool
+	}{
+		{name: "published", marked: true},
+		{name: "handler failed", err: errors.New("broker is down")},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := openTestDB(t, Config{})
+			fake.rows([]string{"id", "entity_type", "entity_key", "action", "changes", "version", "created_at"},
+				[]driver.Value{int64(7), "docs", "1", "update", "[]", int64(2), time.Now()},
+				[]driver.Value{int64(9), "docs", "2", "delete", "[]", int64(5), time.Now()},
+			)
+
+			var got []uint64
+			err := NewRelay(db, "outbox").Process(db.Statement.Context, 10, func(events []OutboxEvent) error {
+				for _, ev := range events {
+					got = append(got, ev.ID)
+				}
+				return tt.err
+			})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Process() = %v; want %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(got, []uint64{7, 9}) {
+				t.Errorf("events = %v; want [7 9]", got)
+			}
+
+			q := fake.take()
+			if len(q) == 0 || q[0].SQL != "SELECT * FROM `outbox` WHERE published_at IS NULL ORDER BY id LIMIT ?" {
+				t.Fatalf("queries = %v", q)
+			}
+			var marked []driver.Value
+			for _, v := range q[1:] {
+				if strings.HasPrefix(v.SQL, "UPDATE `outbox` SET `published_at`=? WHERE id IN (?,?)") {
+					marked = v.Args[1:]
+				}
+			}
+			if tt.marked != (marked != nil) {
+				t.Fatalf("marked = %v; want marked %v", marked, tt.marked)
+			}
+			if tt.marked && !reflect.DeepEqual(marked, []driver.Value{int64(7), int64(9)}) {
+				t.Errorf("marked ids = %v; want [7 9]", marked)
+			}
+		})
+	}
+}
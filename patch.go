@@ -0,0 +1,158 @@
+package gormup
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+type PatchOperation struct {
+	Op    string
+	Path  string
+	Value any
+}
+
+func (op PatchOperation) MarshalJSON() ([]byte, error) {
+	if op.Op == "remove" {
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			Path string `json:"path"`
+		}{op.Op, op.Path})
+	}
+	return json.Marshal(struct {
+		Op    string `json:"op"`
+		Path  string `json:"path"`
+		Value any    `json:"value"`
+	}{op.Op, op.Path, op.Value})
+}
+
+type JSONPatch []PatchOperation
+
+// Patch строит RFC 6902 JSON Patch от снимка к текущему состоянию модели
+// и обратный патч, возвращающий модель к снимку.
+func Patch(db *gorm.DB, model any) (patch JSONPatch, inverse JSONPatch, err error) {
+	p, err := getPlugin(db)
+	if err != nil {
+		return nil, nil, err
+	}
+	ent, err := p.lookupEntity(db, model)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx := db.Statement.Context
+	current := createEntity(ctx, ent.table, ent.schema, nil, reflect.ValueOf(model))
+
+	for _, f := range current.trackedFields() {
+		if getFieldPolicy(f).noCache || !ent.IsKnown(f.DBName) {
+			continue
+		}
+		path, ok := jsonFieldPath(ent.schema, f)
+		if !ok {
+			continue
+		}
+
+		oldVal := ent.fields[f.DBName]
+		newVal := current.fieldValue(ctx, f)
+		if p.config.Comparators.Equal(f, newVal, oldVal) {
+			continue
+		}
+
+		if f.DataType == "json" || f.DataType == "jsonb" {
+			var oldDoc, newDoc map[string]any
+			if unmarshalJSON(toJSON(oldVal), &oldDoc) == nil && oldDoc != nil &&
+				unmarshalJSON(toJSON(newVal), &newDoc) == nil && newDoc != nil {
+				for _, op := range diffJSONBObject(nil, oldDoc, newDoc) {
+					opPath := path + toJSONPointer(op.path)
+					switch {
+					case op.remove:
+						patch = append(patch, PatchOperation{Op: "remove", Path: opPath})
+						inverse = append(inverse, PatchOperation{Op: "add", Path: opPath, Value: op.old})
+					case op.add:
+						patch = append(patch, PatchOperation{Op: "add", Path: opPath, Value: op.value})
+						inverse = append(inverse, PatchOperation{Op: "remove", Path: opPath})
+					default:
+						patch = append(patch, PatchOperation{Op: "replace", Path: opPath, Value: op.value})
+						inverse = append(inverse, PatchOperation{Op: "replace", Path: opPath, Value: op.old})
+					}
+				}
+				continue
+			}
+			oldVal, newVal = decodeJSON(oldVal), decodeJSON(newVal)
+		}
+
+		patch = append(patch, PatchOperation{Op: "replace", Path: path, Value: newVal})
+		inverse = append(inverse, PatchOperation{Op: "replace", Path: path, Value: oldVal})
+	}
+
+	// обратные операции применяются в обратном порядке
+	slices.Reverse(inverse)
+
+	return patch, inverse, nil
+}
+
+// jsonFieldPath строит JSON Pointer поля по json-тегам с учётом вложенных структур.
+func jsonFieldPath(sch *schema.Schema, f *schema.Field) (string, bool) {
+	t := sch.ModelType
+	var path []string
+	for _, name := range f.BindNames {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return "", false
+		}
+		sf, ok := t.FieldByName(name)
+		if !ok {
+			return "", false
+		}
+		jsonName, ok := jsonFieldName(sf)
+		if !ok {
+			return "", false
+		}
+		if jsonName != "" {
+			path = append(path, jsonName)
+		}
+		t = sf.Type
+	}
+	return toJSONPointer(path), true
+}
+
+func jsonFieldName(sf reflect.StructField) (string, bool) {
+	tag := sf.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	if name != "" {
+		return name, true
+	}
+	// анонимные структуры без тега json раскрываются в родителя
+	if sf.Anonymous {
+		return "", true
+	}
+	return sf.Name, true
+}
+
+func toJSONPointer(path []string) string {
+	var b strings.Builder
+	for _, p := range path {
+		p = strings.ReplaceAll(p, "~", "~0")
+		p = strings.ReplaceAll(p, "/", "~1")
+		b.WriteString("/")
+		b.WriteString(p)
+	}
+	return b.String()
+}
+
+func decodeJSON(v any) any {
+	var out any
+	if v == nil || unmarshalJSON(toJSON(v), &out) != nil {
+		return v
+	}
+	return out
+}
@@ -0,0 +1,61 @@
+package gormup
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+type patchContact struct {
+	Phone string `json:"phone"`
+}
+
+type patchedDoc struct {
+	ID      uint64       `gorm:"primaryKey" json:"id"`
+	Title   string       `json:"title"`
+	Secret  string       `json:"-"`
+	Contact patchContact `gorm:"embedded;embeddedPrefix:contact_" json:"contact"`
+	Meta    string       `gorm:"type:jsonb" json:"meta"`
+}
+
+func TestPatch(t *testing.T) {
+	db, _ := openTestDB(t, Config{})
+	d := &patchedDoc{ID: 1, Title: "a", Secret: "s", Contact: patchContact{Phone: "1"}, Meta: `{"a":1,"b":{"x":true}}`}
+	seedEntity(t, db, d)
+
+	d.Title = "a/b"
+	d.Secret = "s2"
+	d.Contact.Phone = "2"
+	d.Meta = `{"a":9007199254740993,"c":"new"}`
+
+	patch, inverse, err := Patch(db, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := json.Marshal(patch)
+	want := `[{"op":"replace","path":"/title","value":"a/b"},` +
+		`{"op":"replace","path":"/contact/phone","value":"2"},` +
+		`{"op":"replace","path":"/meta/a","value":9007199254740993},` +
+		`{"op":"remove","path":"/meta/b"},` +
+		`{"op":"add","path":"/meta/c","value":"new"}]`
+	if string(got) != want {
+		t.Errorf("patch = %s\nwant %s", got, want)
+	}
+
+	got, _ = json.Marshal(inverse)
+	want = `[{"op":"remove","path":"/meta/c"},` +
+		`{"op":"add","path":"/meta/b","value":{"x":true}},` +
+		`{"op":"replace","path":"/meta/a","value":1},` +
+		`{"op":"replace","path":"/contact/phone","value":"1"},` +
+		`{"op":"replace","path":"/title","value":"a"}]`
+	if string(got) != want {
+		t.Errorf("inverse = %s\nwant %s", got, want)
+	}
+}
+
+func TestPatchNotTracked(t *testing.T) {
+	db, _ := openTestDB(t, Config{})
+	if _, _, err := Patch(db, &patchedDoc{ID: 1}); !errors.Is(err, ErrNotTracked) {
+		t.Errorf("Patch() = %v; want ErrNotTracked", err)
+	}
+}
@@ -2,11 +2,10 @@ package gormup
 
 import (
 	"errors"
-	"fmt"
 	"reflect"
-	"slices"
-	"strings"
+	"runtime"
 
+	"github.com/shockerli/cvt"
 	"gorm.io/gorm"
 	"gorm.io/gorm/callbacks"
 	"gorm.io/gorm/clause"
@@ -16,20 +15,53 @@ import (
 const (
 	forceKey = "force"
 
+	commitCallback = "gorm:commit_or_rollback_transaction"
+
 	supportKey             = "gormup:support"
 	entityKey              = "gormup:entity"
 	withoutQueryCacheKey   = "gormup:without_query_cache"
 	withoutReduceUpdateKey = "gormup:without_reduce_update"
+	unitOfWorkKey          = "gormup:unit_of_work"
+	guardKey               = "gormup:guard"
+	compareAndSetKey       = "gormup:compare_and_set"
+	changesKey             = "gormup:changes"
+	deletedKey             = "gormup:deleted"
+	updatedKey             = "gormup:updated"
+	rideAlongKey           = "gormup:ride_along"
+	detachedKey            = "gormup:detached"
+	writeSelectedKey       = "gormup:write_selected"
+	patchJSONBKey          = "gormup:patch_jsonb"
+	unknownKey             = "gormup:unknown"
+	resultKey              = "gormup:result"
+	strictKey              = "gormup:strict"
+	dryRunKey              = "gormup:dry_run"
 )
 
 var ErrNotChanged = errors.New("not changed")
 var ErrAlreadyFetched = errors.New("already fetched")
+var ErrStaleEntity = errors.New("stale entity")
+var ErrConflict = errors.New("conflict")
+var ErrNotTracked = errors.New("entity is not tracked")
 
 type plugin struct {
 	config   Config
 	entities *entityStore
 }
 
+type guard struct {
+	err     error
+	restore func()
+}
+
+func (p *plugin) Name() string {
+	return pluginName
+}
+
+func (p *plugin) Initialize(db *gorm.DB) error {
+	p.register(db)
+	return nil
+}
+
 func (p *plugin) register(db *gorm.DB) {
 	queryCallback := db.Callback().Query()
 	queryCallback.Before("gorm:query").Register("gormup:before_query", p.beforeQuery)
@@ -38,13 +70,14 @@ func (p *plugin) register(db *gorm.DB) {
 
 	updateCallback := db.Callback().Update()
 	updateCallback.Before("gorm:update").Register("gormup:before_update", p.beforeUpdate)
-	updateCallback.After("gorm:update").Register("gormup:after_update", p.afterUpdate)
+	updateCallback.After("gorm:update").Before(commitCallback).Register("gormup:after_update", p.afterUpdate)
 
 	createCallback := db.Callback().Create()
-	createCallback.After("*").Register("gormup:after_create", p.afterCreate)
+	createCallback.After("*").Before(commitCallback).Register("gormup:after_create", p.afterCreate)
 
-	deleteCallback := db.Callback().Update()
+	deleteCallback := db.Callback().Delete()
 	deleteCallback.Before("*").Register("gormup:before_delete", p.beforeDelete)
+	deleteCallback.After("gorm:delete").Before(commitCallback).Register("gormup:after_delete", p.afterDelete)
 }
 
 func (p *plugin) withoutQueryCache(db *gorm.DB) bool {
@@ -61,6 +94,70 @@ func (p *plugin) withoutReduceUpdate(db *gorm.DB) bool {
 	return p.getBool(db, withoutReduceUpdateKey, false) || p.getBool(db, forceKey, false)
 }
 
+func (p *plugin) strict(db *gorm.DB) bool {
+	if p.config.Strict {
+		return true
+	}
+	return p.getBool(db, strictKey, false)
+}
+
+func (p *plugin) compareAndSet(db *gorm.DB) bool {
+	if p.config.CompareAndSet {
+		return true
+	}
+	return p.getBool(db, compareAndSetKey, false)
+}
+
+func (p *plugin) writeSelected(db *gorm.DB) bool {
+	if p.config.WriteSelected {
+		return true
+	}
+	return p.getBool(db, writeSelectedKey, false)
+}
+
+// getForcedColumns возвращает колонки, явно перечисленные в Select: их пишем
+// без сравнения со снимком. "*" не считается: его неявно выбирает Save.
+func (p *plugin) getForcedColumns(db *gorm.DB) map[string]bool {
+	if !p.writeSelected(db) || db.Statement.Schema == nil {
+		return nil
+	}
+	forced := map[string]bool{}
+	for _, name := range db.Statement.Selects {
+		if name == "*" {
+			// Save подставляет "*" сам, форсируем только явный выбор
+			if calledFromSave() {
+				continue
+			}
+			for _, f := range db.Statement.Schema.Fields {
+				if f.DBName != "" {
+					forced[f.DBName] = true
+				}
+			}
+			continue
+		}
+		if f := db.Statement.Schema.LookUpField(name); f != nil && f.DBName != "" {
+			forced[f.DBName] = true
+		}
+	}
+	return forced
+}
+
+// calledFromSave проверяет, что обновление запущено из db.Save: в Statement
+// неявный Select("*") от Save ничем не отличается от явного
+func calledFromSave() bool {
+	pcs := make([]uintptr, 64)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		if frame.Function == "gorm.io/gorm.(*DB).Save" {
+			return true
+		}
+		if !more {
+			return false
+		}
+	}
+}
+
 func (p *plugin) getOtherPrimaryKeys(sch *schema.Schema) (keys []string) {
 	if p.config.OtherPrimaryKeys != nil {
 		for _, name := range p.config.OtherPrimaryKeys[sch.Table] {
@@ -73,12 +170,44 @@ func (p *plugin) getOtherPrimaryKeys(sch *schema.Schema) (keys []string) {
 	return keys
 }
 
+// keyTable возвращает фактическую таблицу запроса (Table("documents_2024")
+// или шард) и пространство ключей из Config.KeyNamespace.
+func (p *plugin) keyTable(db *gorm.DB, sch *schema.Schema) (entityTable, bool) {
+	if sch == nil {
+		return entityTable{}, false
+	}
+	table := entityTable{name: sch.Table}
+	if stmt := db.Statement; stmt.Schema == nil || stmt.Schema == sch {
+		var ok bool
+		if table.name, ok = effectiveTable(stmt, sch); !ok {
+			return entityTable{}, false
+		}
+	}
+	if p.config.KeyNamespace != nil {
+		table.namespace = p.config.KeyNamespace(db)
+	}
+	return table, true
+}
+
+func (p *plugin) getVersionField(sch *schema.Schema) *schema.Field {
+	if name, ok := p.config.VersionColumns[sch.Table]; ok {
+		return sch.LookUpField(name)
+	}
+	for _, f := range sch.Fields {
+		if f.DBName != "" && getFieldPolicy(f).version {
+			return f
+		}
+	}
+	return nil
+}
+
 func (p *plugin) isSupportSelect(db *gorm.DB) bool {
 	if db.Error != nil {
 		return false
 	}
 	if db.Statement == nil ||
 		db.Statement.Schema == nil ||
+		db.Statement.Schema.PrioritizedPrimaryField == nil ||
 		len(db.Statement.Schema.PrimaryFields) > 1 {
 		return false
 	}
@@ -87,9 +216,12 @@ func (p *plugin) isSupportSelect(db *gorm.DB) bool {
 		return false
 	}
 
-	isSelectAll := len(db.Statement.Selects) == 0 ||
-		slices.Contains(db.Statement.Selects, "*")
-	if !isSelectAll {
+	if p.config.Policy.Verdict(db.Statement, 0) == VerdictBypass {
+		return false
+	}
+
+	// FROM из подзапроса или выражения: неясно, чьи строки кешировать
+	if _, ok := p.keyTable(db, db.Statement.Schema); !ok {
 		return false
 	}
 
@@ -101,6 +233,11 @@ func (p *plugin) isSupportSelect(db *gorm.DB) bool {
 	return true
 }
 
+func (p *plugin) isLocking(db *gorm.DB) bool {
+	_, ok := db.Statement.Clauses["FOR"]
+	return ok
+}
+
 func (p *plugin) beforeQuery(db *gorm.DB) {
 	if !p.isSupportSelect(db) {
 		return
@@ -108,7 +245,9 @@ func (p *plugin) beforeQuery(db *gorm.DB) {
 
 	db.Set(supportKey, true)
 
-	if p.withoutQueryCache(db) {
+	// блокирующее чтение всегда идет в БД, а результат обновляет кеш;
+	// Policy может это ужесточить, но не ослабить
+	if p.withoutQueryCache(db) || p.isLocking(db) {
 		return
 	}
 
@@ -135,26 +274,53 @@ func (p *plugin) extractModelsByColumn(columnName string, db *gorm.DB) bool {
 		return false
 	}
 
+	if p.config.Policy.Verdict(db.Statement, len(values)) != VerdictCache {
+		return false
+	}
+
+	// в сторе нет значений nocache-колонок, отдать из него модель нельзя
+	if hasNoCacheFields(db.Statement.Schema) {
+		return false
+	}
+
+	if db.Statement.Dest == nil || !isCacheableDest(reflect.TypeOf(db.Statement.Dest), len(values)) {
+		return false
+	}
+
 	ctx := db.Statement.Context
-	tableName := db.Statement.Schema.Table
+	tableName, _ := p.keyTable(db, db.Statement.Schema)
 
+	ents := make([]*entity, len(values))
 	reflectModels := make([]reflect.Value, len(values))
 	for i, value := range values {
-		ent := p.entities.GetByFieldValue(ctx, tableName, columnName, value)
-		if ent != nil {
-			reflectModels[i] = ent.reflectValue
-		} else {
+		ent := p.entities.GetByFieldValue(ctx, tableName.key(), columnName, value)
+		if ent == nil {
 			return false
 		}
+		ents[i] = ent
+		reflectModels[i] = ent.reflectValue
 	}
 
-	if len(reflectModels) != len(values) {
-		return false
+	if p.dryRun(db) {
+		// модель не заполняем: gorm только соберет SQL
+		p.getReport(db).FromCache = true
+		return true
 	}
 
 	dest := reflect.ValueOf(db.Statement.Dest)
 	setValue(dest, reflectModels...)
 
+	if uow := p.getUnitOfWork(db); uow != nil {
+		// UoW сверяет модель, которую получил вызывающий, а не копию в сторе
+		for i, value := range p.extractEntityValues(db.Statement.Dest) {
+			if i < len(ents) {
+				view := *ents[i]
+				view.reflectValue = value
+				uow.track(&view)
+			}
+		}
+	}
+
 	db.Error = ErrAlreadyFetched
 
 	return true
@@ -166,7 +332,7 @@ func (p *plugin) afterQuery(db *gorm.DB) {
 	}
 
 	_, sup := db.Get(supportKey)
-	if !sup {
+	if !sup || p.dryRun(db) {
 		return
 	}
 
@@ -174,6 +340,10 @@ func (p *plugin) afterQuery(db *gorm.DB) {
 }
 
 func (p *plugin) afterAllQuery(db *gorm.DB) {
+	if p.dryRun(db) {
+		p.finishReport(db)
+	}
+
 	_, sup := db.Get(supportKey)
 	if !sup {
 		return
@@ -191,43 +361,141 @@ func (p *plugin) afterCreate(db *gorm.DB) {
 	if db.Error != nil {
 		return
 	}
-	p.setEntities(db)
+	if p.dryRun(db) {
+		p.finishReport(db)
+		return
+	}
+	for _, ent := range p.setEntities(db) {
+		p.emit(db, AuditCreate, newCreateChangeSet(ent))
+	}
 }
 
 func (p *plugin) beforeDelete(db *gorm.DB) {
-	if db.Statement == nil || db.Statement.Schema == nil {
+	if db.Statement == nil || db.Statement.Schema == nil || p.dryRun(db) {
 		return
 	}
 
-	columnName := db.Statement.Schema.PrioritizedPrimaryField.DBName
-	tableName := db.Statement.Schema.Table
+	ctx := db.Statement.Context
+	sch := db.Statement.Schema
+	table, ids := p.getConditionIDs(db)
 
-	ids, ok := p.extractColumnValuesFromConditions(columnName, db.Statement)
+	var deleted []*changeSet
+	for _, id := range ids {
+		key := getEntityKey(table.key(), sch.PrioritizedPrimaryField.DBName, id)
+		if ent := p.entities.Get(ctx, key); ent != nil {
+			deleted = append(deleted, newDeleteChangeSet(ent))
+		} else {
+			// снимка нет: в аудит попадает только ключ
+			deleted = append(deleted, &changeSet{schema: sch, table: table.name, key: id})
+		}
+		p.entities.Delete(ctx, key)
+	}
+	if len(ids) == 0 {
+		deleted = append(deleted, p.newConditionChangeSet(db.Statement, table))
+	}
+	db.Set(deletedKey, deleted)
+}
+
+func (p *plugin) afterDelete(db *gorm.DB) {
+	if p.dryRun(db) {
+		p.finishReport(db)
+		return
+	}
+
+	v, ok := db.Get(deletedKey)
 	if !ok {
 		return
 	}
+	db.Statement.Settings.Delete(deletedKey)
 
+	if db.Error != nil || db.RowsAffected == 0 {
+		return
+	}
+	deleted, _ := v.([]*changeSet)
+	for _, cs := range deleted {
+		p.emit(db, AuditDelete, cs)
+	}
+}
+
+func (p *plugin) getConditionKeys(db *gorm.DB) (keys []string) {
+	sch := db.Statement.Schema
+	if sch == nil || sch.PrioritizedPrimaryField == nil {
+		// составной ключ или его нет: по условиям строку не адресовать
+		return nil
+	}
+	table, ids := p.getConditionIDs(db)
+	columnName := sch.PrioritizedPrimaryField.DBName
 	for _, id := range ids {
-		p.entities.Delete(db.Statement.Context, getEntityKey(tableName, columnName, id))
+		keys = append(keys, getEntityKey(table.key(), columnName, id))
+	}
+	return keys
+}
+
+// getConditionIDs собирает идентификаторы затронутых строк из условий и модели.
+func (p *plugin) getConditionIDs(db *gorm.DB) (entityTable, []string) {
+	ctx := db.Statement.Context
+	sch := db.Statement.Schema
+
+	if sch == nil {
+		return entityTable{}, nil
+	}
+	table, ok := p.keyTable(db, sch)
+	if !ok || sch.PrioritizedPrimaryField == nil {
+		return entityTable{name: sch.Table}, nil
 	}
+
+	ids, _ := p.extractColumnValuesFromConditions(sch.PrioritizedPrimaryField.DBName, db.Statement)
+
+	if db.Statement.Model != nil {
+		for _, value := range p.extractEntityValues(db.Statement.Model) {
+			if ent := createEntity(ctx, table, sch, nil, value); ent != nil {
+				ids = append(ids, ent.id)
+			}
+		}
+	}
+
+	return table, uniqueValues(ids)
 }
 
-func (p *plugin) setEntities(db *gorm.DB) {
+func (p *plugin) setEntities(db *gorm.DB) (out []*entity) {
 	ctx := db.Statement.Context
+	table, ok := p.keyTable(db, db.Statement.Schema)
+	if !ok {
+		return nil
+	}
 	values := p.extractEntityValues(db.Statement.Dest)
 	for _, value := range values {
 		ent := createEntity(
 			ctx,
+			table,
 			db.Statement.Schema,
 			p.getOtherPrimaryKeys(db.Statement.Schema),
 			value,
 		)
 		if ent == nil {
-			return
+			return out
 		}
+		ent.comparators = p.config.Comparators
 		ent.Sync(ctx)
+		if p.isLocking(db) {
+			if _, ok := db.Statement.ConnPool.(gorm.TxCommitter); ok {
+				ent.lockedBy = db.Statement.ConnPool
+			}
+		}
+		// UoW сверяет модель вызывающего, в стор уходит копия без nocache-полей
+		tracked := ent
+		if hasNoCacheFields(ent.schema) {
+			view := *ent
+			tracked = &view
+			ent.dropNoCache(ctx)
+		}
 		p.entities.Set(ctx, ent)
+		if uow := p.getUnitOfWork(db); uow != nil {
+			uow.track(tracked)
+		}
+		out = append(out, ent)
 	}
+	return out
 }
 
 func (p *plugin) extractEntityValues(dest any) (out []reflect.Value) {
@@ -273,7 +541,6 @@ func (p *plugin) extractColumnValuesFromConditions(name string, st *gorm.Stateme
 	}
 
 	columnName := field.DBName
-	tableName := st.Schema.Table
 
 	var clauseWhere clause.Clause
 	for _, cl := range st.Clauses {
@@ -297,25 +564,18 @@ func (p *plugin) extractColumnValuesFromConditions(name string, st *gorm.Stateme
 
 	switch expr := where.Exprs[0].(type) {
 	case clause.Expr:
-		if len(expr.Vars) != 1 {
-			return nil, false
-		}
-
-		given := strings.ToLower(strings.ReplaceAll(expr.SQL, " ", ""))
-		expect := strings.ToLower(fmt.Sprintf("%s=?", columnName))
-		if given != expect {
-			return nil, false
-		}
-		return []string{toString(expr.Vars[0])}, true
+		return extractExprValues(st, columnName, expr.SQL, expr.Vars, false)
+	case clause.NamedExpr:
+		return extractExprValues(st, columnName, expr.SQL, expr.Vars, true)
 	case clause.IN:
-		if len(expr.Values) != 1 {
+		if len(expr.Values) == 0 {
 			return nil, false
 		}
 		col, ok := expr.Column.(clause.Column)
 		if !ok {
 			return nil, false
 		}
-		if col.Table != clause.CurrentTable && col.Table != tableName {
+		if col.Table != clause.CurrentTable && !matchQualifier(st, col.Table) {
 			return nil, false
 		}
 		if col.Name != clause.PrimaryKey && col.Name != columnName {
@@ -325,13 +585,13 @@ func (p *plugin) extractColumnValuesFromConditions(name string, st *gorm.Stateme
 		for i, v := range expr.Values {
 			values[i] = toString(v)
 		}
-		return values, true
+		return uniqueValues(values), true
 	case clause.Eq:
 		col, ok := expr.Column.(clause.Column)
 		if !ok {
 			return nil, false
 		}
-		if col.Table != clause.CurrentTable && col.Table != tableName {
+		if col.Table != clause.CurrentTable && !matchQualifier(st, col.Table) {
 			return nil, false
 		}
 		if col.Name != clause.PrimaryKey && col.Name != columnName {
@@ -352,10 +612,20 @@ func (p *plugin) beforeUpdate(db *gorm.DB) {
 		return
 	}
 
+	if p.dryRun(db) {
+		p.keepDest(db)
+	}
+
 	if p.withoutReduceUpdate(db) {
+		p.buildUntrackedUpdate(db)
 		return
 	}
 
+	db.Statement.Settings.Delete(resultKey)
+
+	// ищем снимок по условиям до того, как soft delete добавит свои
+	p.findDetachedEntity(db)
+
 	if db.Statement.Schema != nil {
 		for _, c := range db.Statement.Schema.UpdateClauses {
 			db.Statement.AddClause(c)
@@ -368,11 +638,27 @@ func (p *plugin) beforeUpdate(db *gorm.DB) {
 		if _, ok := db.Statement.Clauses["SET"]; !ok {
 			if set := callbacks.ConvertToAssignments(db.Statement); len(set) != 0 {
 				defer delete(db.Statement.Clauses, "SET")
+				original := set
 				set = p.reduceUpdateSet(db, set)
+				if db.Error != nil {
+					return
+				}
 				if len(set) == 0 {
+					p.setResult(db, original, set)
 					_ = db.AddError(ErrNotChanged)
 					return
 				}
+				set = p.applyVersion(db, set)
+				p.setResult(db, original, set)
+				p.setUpdateChangeSet(db, set)
+				if !p.dryRun(db) {
+					if err := p.notify(db, listeners.before, p.getChangeSet(db)); err != nil {
+						_ = db.AddError(err)
+						return
+					}
+				}
+				set = p.applyJSONBPatch(db, set)
+				p.applyCompareAndSet(db, set)
 				db.Statement.AddClause(set)
 			} else {
 				return
@@ -383,70 +669,502 @@ func (p *plugin) beforeUpdate(db *gorm.DB) {
 	}
 }
 
+// buildUntrackedUpdate собирает UPDATE так же, как gorm, без редукции,
+// но запоминает SET для аудита.
+func (p *plugin) buildUntrackedUpdate(db *gorm.DB) {
+	if db.Statement.SQL.Len() != 0 {
+		return
+	}
+	if db.Statement.Schema != nil {
+		for _, c := range db.Statement.Schema.UpdateClauses {
+			db.Statement.AddClause(c)
+		}
+	}
+
+	db.Statement.SQL.Grow(180)
+	db.Statement.AddClauseIfNotExists(clause.Update{})
+	if c, ok := db.Statement.Clauses["SET"]; ok {
+		set, _ := c.Expression.(clause.Set)
+		db.Set(updatedKey, p.newUntrackedUpdateChangeSets(db, set))
+	} else if set := callbacks.ConvertToAssignments(db.Statement); len(set) != 0 {
+		defer delete(db.Statement.Clauses, "SET")
+		db.Statement.AddClause(set)
+		db.Set(updatedKey, p.newUntrackedUpdateChangeSets(db, set))
+	} else {
+		return
+	}
+
+	db.Statement.Build(db.Statement.BuildClauses...)
+}
+
+// emitUntracked пишет аудит обновлений, для которых снимка не было
+func (p *plugin) emitUntracked(db *gorm.DB) {
+	v, ok := db.Get(updatedKey)
+	if !ok {
+		return
+	}
+	db.Statement.Settings.Delete(updatedKey)
+
+	if db.Error != nil || db.RowsAffected == 0 {
+		return
+	}
+	updated, _ := v.([]*changeSet)
+	for _, cs := range updated {
+		p.emit(db, AuditUpdate, cs)
+	}
+}
+
 func (p *plugin) afterUpdate(db *gorm.DB) {
+	if p.dryRun(db) {
+		p.afterDryRunUpdate(db)
+		return
+	}
+
 	if p.withoutReduceUpdate(db) {
+		p.emitUntracked(db)
+		p.evictEntities(db)
 		return
 	}
 
+	// на время обновления сущность смотрит на модель вызывающего
+	defer p.getEntity(db).dropNoCache(db.Statement.Context)
+
 	if errors.Is(db.Error, ErrNotChanged) {
-		db.Error = nil
-		db.RowsAffected = -1
-	} else {
-		p.getEntity(db).Sync(db.Statement.Context)
+		if p.strict(db) {
+			db.RowsAffected = 0
+		} else {
+			// -1, а не 0: на 0 Save уходит в upsert через Create
+			db.Error = nil
+			db.RowsAffected = -1
+		}
+	} else if p.checkGuard(db) {
+		if db.Error == nil {
+			cs := p.getChangeSet(db)
+			p.emit(db, AuditUpdate, cs)
+			_ = db.AddError(p.notify(db, listeners.after, cs))
+		}
+		p.emitUntracked(db)
+		if ent := p.getEntity(db); ent != nil {
+			// при ошибке запись отменена или откатится: снимок по-прежнему совпадает с БД
+			if db.Error == nil {
+				updated := p.syncUpdated(db, ent)
+				if res := p.getResult(db); res != nil {
+					res.CacheUpdated = updated
+				}
+			}
+		} else {
+			p.evictEntities(db)
+		}
 		p.deleteEntity(db)
 	}
+	p.deleteChangeSet(db)
+	db.Statement.Settings.Delete(updatedKey)
+	db.Statement.Settings.Delete(rideAlongKey)
+	db.Statement.Settings.Delete(unknownKey)
+	db.Statement.Settings.Delete(detachedKey)
+}
+
+func (p *plugin) afterDryRunUpdate(db *gorm.DB) {
+	r := p.getReport(db)
+	if errors.Is(db.Error, ErrNotChanged) {
+		r.Skipped = true
+		if !p.strict(db) {
+			db.Error = nil
+			db.RowsAffected = -1
+		}
+	}
+	if cs := p.getChangeSet(db); cs != nil {
+		r.Changes = cs.changes
+	}
+
+	if v, ok := db.Get(guardKey); ok {
+		if g, _ := v.(*guard); g != nil && g.restore != nil {
+			g.restore()
+		}
+	}
+	p.finishReport(db)
+
+	db.Statement.Settings.Delete(guardKey)
+	p.deleteEntity(db)
+	p.deleteChangeSet(db)
+	db.Statement.Settings.Delete(updatedKey)
+	db.Statement.Settings.Delete(rideAlongKey)
+	db.Statement.Settings.Delete(unknownKey)
+	db.Statement.Settings.Delete(detachedKey)
+}
+
+func (p *plugin) findDetachedEntity(db *gorm.DB) {
+	if ent := p.lookupDetachedEntity(db); ent != nil {
+		db.Set(detachedKey, ent)
+	}
+}
+
+func (p *plugin) lookupDetachedEntity(db *gorm.DB) *entity {
+	sch := db.Statement.Schema
+	if sch == nil || sch.PrioritizedPrimaryField == nil {
+		return nil
+	}
+	table, ok := p.keyTable(db, sch)
+	if !ok || createEntity(db.Statement.Context, table, sch, nil, db.Statement.ReflectValue) != nil {
+		return nil
+	}
+
+	columns := append([]string{sch.PrioritizedPrimaryField.DBName}, p.getOtherPrimaryKeys(sch)...)
+	for _, column := range columns {
+		values, ok := p.extractColumnValuesFromConditions(column, db.Statement)
+		if !ok || len(values) != 1 {
+			continue
+		}
+		if ent := p.entities.GetByFieldValue(db.Statement.Context, table.key(), column, values[0]); ent != nil {
+			return ent
+		}
+	}
+	return nil
+}
+
+func (p *plugin) getDetachedEntity(db *gorm.DB) *entity {
+	v, ok := db.Get(detachedKey)
+	if !ok {
+		return nil
+	}
+	ent, _ := v.(*entity)
+	return ent
+}
+
+// patchEntity переносит записанные значения в закешированную модель,
+// когда обновление шло через Model(&T{}).Where(...) без загруженного экземпляра.
+func (p *plugin) patchEntity(db *gorm.DB, ent *entity, columns []string) bool {
+	ctx := db.Statement.Context
+	src := db.Statement.ReflectValue
+	if src.Kind() != reflect.Struct || !src.CanAddr() || !canSet(ent.reflectValue) {
+		p.entities.Delete(ctx, ent.GetKey())
+		return false
+	}
+
+	versionField := p.getVersionField(ent.schema)
+	for _, column := range columns {
+		f, ok := ent.schema.FieldsByDBName[column]
+		if !ok || f == versionField || getFieldPolicy(f).noCache {
+			continue
+		}
+		f.ReflectValueOf(ctx, ent.reflectValue).Set(f.ReflectValueOf(ctx, src))
+	}
+	return true
+}
+
+func (p *plugin) syncUpdated(db *gorm.DB, ent *entity) bool {
+	v, _ := db.Get(unknownKey)
+	exprSet, _ := v.(clause.Set)
+	exprColumns := make(map[string]bool, len(exprSet))
+	for _, a := range exprSet {
+		exprColumns[a.Column.Name] = true
+	}
+
+	// в снимок попадают только реально записанные колонки: при Updates(map)
+	// и частичных обновлениях остальные поля модели могут отличаться от БД
+	synced := false
+	if cs := p.getChangeSet(db); cs != nil {
+		var columns []string
+		for _, c := range cs.changes {
+			if exprColumns[c.Column] {
+				continue
+			}
+			columns = append(columns, c.Column)
+			ent.MarkKnown(c.Column)
+		}
+		synced = true
+		source := ent
+		if p.getDetachedEntity(db) == ent {
+			synced = p.patchEntity(db, ent, columns)
+			if synced && ent.fields != nil {
+				// nocache-поля в модель из стора не переносятся, снимок берем из записанной
+				source = &entity{schema: ent.schema, reflectValue: db.Statement.ReflectValue, fields: ent.fields}
+			}
+		}
+		source.SyncColumns(db.Statement.Context, columns...)
+	}
+
+	for column := range exprColumns {
+		ent.MarkUnknown(column)
+	}
+	return synced
+}
+
+func (p *plugin) evictEntities(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return
+	}
+	for _, key := range p.getConditionKeys(db) {
+		p.entities.Delete(db.Statement.Context, key)
+	}
+}
+
+func (p *plugin) setUpdateChangeSet(db *gorm.DB, set clause.Set) {
+	ent := p.getEntity(db)
+	if ent == nil {
+		table, _ := p.keyTable(db, db.Statement.Schema)
+		ent = createEntity(db.Statement.Context, table, db.Statement.Schema, nil, db.Statement.ReflectValue)
+	}
+	if ent == nil {
+		// массовое обновление: ключи из условий, старые значения неизвестны
+		db.Set(updatedKey, p.newUntrackedUpdateChangeSets(db, set))
+		return
+	}
+	v, _ := db.Get(rideAlongKey)
+	rideAlong, _ := v.(map[string]bool)
+	p.setChangeSet(db, newUpdateChangeSet(db.Statement.Context, ent, set, rideAlong))
+}
+
+func (p *plugin) applyVersion(db *gorm.DB, set clause.Set) clause.Set {
+	ent := p.getEntity(db)
+	if ent == nil {
+		return set
+	}
+	f := p.getVersionField(db.Statement.Schema)
+	if f == nil || !canSet(ent.reflectValue) || !ent.IsKnown(f.DBName) {
+		return set
+	}
+
+	current, err := cvt.Int64E(ent.fields[f.DBName])
+	if err != nil {
+		return set
+	}
+	next := current + 1
+
+	ctx := db.Statement.Context
+	if db.AddError(f.Set(ctx, ent.reflectValue, next)) != nil {
+		return set
+	}
+
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: f.DBName}, Value: current},
+	}})
+	db.Set(guardKey, &guard{
+		err: ErrStaleEntity,
+		restore: func() {
+			_ = f.Set(ctx, ent.reflectValue, current)
+		},
+	})
+
+	return append(set, clause.Assignment{Column: clause.Column{Name: f.DBName}, Value: next})
+}
+
+func (p *plugin) applyCompareAndSet(db *gorm.DB, set clause.Set) {
+	if !p.compareAndSet(db) {
+		return
+	}
+	ent := p.getEntity(db)
+	if ent == nil {
+		return
+	}
+
+	sch := db.Statement.Schema
+	versionField := p.getVersionField(sch)
+
+	var exprs []clause.Expression
+	for _, v := range set {
+		f, ok := sch.FieldsByDBName[v.Column.Name]
+		if !ok || f == versionField || f.AutoUpdateTime > 0 || getFieldPolicy(f).noCache {
+			continue
+		}
+		// выражения применяются к текущему значению в БД, сверять его не нужно
+		if !isSupportForUpdate(v.Value) {
+			continue
+		}
+		// у json в postgres нет оператора сравнения
+		if f.DataType == "json" {
+			continue
+		}
+		original, ok := ent.fields[f.DBName]
+		if !ok || !ent.IsKnown(f.DBName) {
+			continue
+		}
+		exprs = append(exprs, clause.Eq{
+			Column: clause.Column{Table: clause.CurrentTable, Name: f.DBName},
+			Value:  original,
+		})
+	}
+	if len(exprs) == 0 {
+		return
+	}
+
+	db.Statement.AddClause(clause.Where{Exprs: exprs})
+	if _, ok := db.Get(guardKey); !ok {
+		db.Set(guardKey, &guard{err: ErrConflict})
+	}
+}
+
+func (p *plugin) checkGuard(db *gorm.DB) bool {
+	v, ok := db.Get(guardKey)
+	if !ok {
+		return true
+	}
+	db.Statement.Settings.Delete(guardKey)
+
+	g, _ := v.(*guard)
+	if g == nil || (db.Error == nil && (db.RowsAffected > 0 || db.DryRun)) {
+		return true
+	}
+
+	if g.restore != nil {
+		g.restore()
+	}
+
+	if db.Error == nil {
+		if ent := p.getEntity(db); ent != nil {
+			p.entities.Delete(db.Statement.Context, ent.GetKey())
+		}
+		_ = db.AddError(g.err)
+	}
+	p.deleteEntity(db)
+
+	return false
 }
 
 func (p *plugin) reduceUpdateSet(db *gorm.DB, set clause.Set) clause.Set {
 
 	ctx := db.Statement.Context
 
-	current := createEntity(ctx, db.Statement.Schema, nil, db.Statement.ReflectValue)
-	if current == nil {
+	table, ok := p.keyTable(db, db.Statement.Schema)
+	if !ok {
 		return set
 	}
 
-	original := p.entities.Get(ctx, current.GetKey())
-	if original == nil {
+	var original *entity
+	if current := createEntity(ctx, table, db.Statement.Schema, nil, db.Statement.ReflectValue); current != nil {
+		original = p.entities.Get(ctx, current.GetKey())
+		if original == nil {
+			return set
+		}
+		if p.dryRun(db) {
+			ent, rv := original, original.reflectValue
+			r := p.getReport(db)
+			r.restore = append(r.restore, func() { ent.reflectValue = rv })
+		}
+		original.reflectValue = current.reflectValue
+	} else if original = p.getDetachedEntity(db); original == nil {
 		return set
 	}
-	original.reflectValue = current.reflectValue
 
 	p.setEntity(db, original)
 
 	sch := db.Statement.Schema
 
+	versionField := p.getVersionField(sch)
+	forced := p.getForcedColumns(db)
+	explicit := p.getExplicitColumns(db)
+
 	var changedSet clause.Set
-	var autoUpdateSet clause.Set
+	var rideAlongSet clause.Set
+	var exprSet clause.Set
+	assigned := make(map[string]bool, len(set))
 	for _, v := range set {
-		if !isSupportForUpdate(v) {
+		f, ok := sch.FieldsByDBName[v.Column.Name]
+		if !ok || !isSupportForUpdate(v.Value) {
+			// выражения и неизвестные колонки сравнить не с чем, пишем как есть
+			exprSet = append(exprSet, v)
 			continue
 		}
-		f, ok := sch.FieldsByDBName[v.Column.Name]
-		if !ok {
+		assigned[f.DBName] = true
+		if f == versionField {
 			continue
 		}
 
-		newVal := toString(v.Value)
-		originalVal := original.fields[f.DBName]
-		if newVal == originalVal {
+		fp := getFieldPolicy(f)
+		if fp.ignore {
+			if explicit[f.DBName] {
+				changedSet = append(changedSet, v)
+			} else {
+				rideAlongSet = append(rideAlongSet, v)
+			}
 			continue
 		}
 
-		if f.AutoUpdateTime > 0 {
-			autoUpdateSet = append(autoUpdateSet, v)
-		} else {
+		newVal := toFieldSnapshot(f, normalizeValue(ctx, f, original.reflectValue, v.Value))
+		originalVal, known := original.fields[f.DBName]
+		// после выражения значение в снимке устарело
+		known = known && original.IsKnown(f.DBName)
+		changed := !known || !p.config.Comparators.Equal(f, newVal, originalVal)
+
+		if changed && known && fp.immutable {
+			_ = db.AddError(immutableFieldError(f))
+			return nil
+		}
+
+		if changed || forced[f.DBName] {
 			changedSet = append(changedSet, v)
+		} else if fp.always {
+			rideAlongSet = append(rideAlongSet, v)
 		}
 	}
 
-	if len(changedSet) > 0 && len(autoUpdateSet) > 0 {
-		changedSet = append(changedSet, autoUpdateSet...)
+	if len(exprSet) > 0 {
+		changedSet = append(changedSet, exprSet...)
+		db.Set(unknownKey, exprSet)
+	}
+
+	if len(changedSet) > 0 {
+		if original != p.getDetachedEntity(db) {
+			rideAlongSet = append(rideAlongSet, p.getAlwaysSet(db, original, assigned)...)
+		}
+		changedSet = append(changedSet, rideAlongSet...)
+		rideAlong := make(map[string]bool, len(rideAlongSet))
+		for _, v := range rideAlongSet {
+			rideAlong[v.Column.Name] = true
+		}
+		db.Set(rideAlongKey, rideAlong)
 	}
 
 	return changedSet
 }
 
+// getExplicitColumns возвращает колонки, которые вызывающий назвал сам:
+// ключи map в Updates/Update и имена в Select.
+func (p *plugin) getExplicitColumns(db *gorm.DB) map[string]bool {
+	sch := db.Statement.Schema
+	explicit := map[string]bool{}
+
+	var names []string
+	switch dest := db.Statement.Dest.(type) {
+	case map[string]any:
+		for name := range dest {
+			names = append(names, name)
+		}
+	case *map[string]any:
+		for name := range *dest {
+			names = append(names, name)
+		}
+	}
+	for _, name := range db.Statement.Selects {
+		if name != "*" {
+			names = append(names, name)
+		}
+	}
+
+	for _, name := range names {
+		if f := sch.LookUpField(name); f != nil && f.DBName != "" {
+			explicit[f.DBName] = true
+		}
+	}
+	return explicit
+}
+
+func (p *plugin) getAlwaysSet(db *gorm.DB, ent *entity, assigned map[string]bool) (set clause.Set) {
+	ctx := db.Statement.Context
+	selectColumns, restricted := db.Statement.SelectAndOmitColumns(false, true)
+	for _, f := range ent.schema.Fields {
+		if f.DBName == "" || !f.Updatable || assigned[f.DBName] || !getFieldPolicy(f).always {
+			continue
+		}
+		if v, ok := selectColumns[f.DBName]; (ok && !v) || (!ok && restricted) {
+			continue
+		}
+		value, _ := f.ValueOf(ctx, ent.reflectValue)
+		set = append(set, clause.Assignment{Column: clause.Column{Name: f.DBName}, Value: value})
+	}
+	return set
+}
+
 func (p *plugin) getBool(db *gorm.DB, key string, def bool) bool {
 	v, ok := db.Get(key)
 	if !ok {
@@ -459,6 +1177,38 @@ func (p *plugin) getBool(db *gorm.DB, key string, def bool) bool {
 	return boolVal
 }
 
+func (p *plugin) lookupEntity(db *gorm.DB, model any) (*entity, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, err
+	}
+
+	table, ok := p.keyTable(db, stmt.Schema)
+	if !ok {
+		return nil, ErrNotTracked
+	}
+
+	ctx := db.Statement.Context
+	current := createEntity(ctx, table, stmt.Schema, nil, reflect.ValueOf(model))
+	if current == nil {
+		return nil, ErrNotTracked
+	}
+	ent := p.entities.Get(ctx, current.GetKey())
+	if ent == nil {
+		return nil, ErrNotTracked
+	}
+	return ent, nil
+}
+
+func (p *plugin) getUnitOfWork(db *gorm.DB) *UnitOfWork {
+	v, ok := db.Get(unitOfWorkKey)
+	if !ok {
+		return nil
+	}
+	uow, _ := v.(*UnitOfWork)
+	return uow
+}
+
 func (p *plugin) getEntity(db *gorm.DB) *entity {
 	v, ok := db.Get(entityKey)
 	if !ok {
@@ -0,0 +1,543 @@
+package gormup
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type versionedDoc struct {
+	ID      uint64 `gorm:"primaryKey"`
+	Name    string
+	Number  int64
+	Version int64 `gormup:"version"`
+}
+
+func TestVersion(t *testing.T) {
+	cases := []struct {
+		name string
+		save func(db *gorm.DB, d *versionedDoc) *gorm.DB
+		sql  string
+		vars []any
+	}{
+		{
+			name: "save",
+			save: func(db *gorm.DB, d *versionedDoc) *gorm.DB {
+				d.Name = "b"
+				return DryRun(db).Save(d)
+			},
+			sql:  "UPDATE `versioned_docs` SET `name`=?,`version`=? WHERE `id` = ? AND `versioned_docs`.`version` = ?",
+			vars: []any{"b", int64(4), uint64(1), int64(3)},
+		},
+		{
+			name: "updates",
+			save: func(db *gorm.DB, d *versionedDoc) *gorm.DB {
+				return DryRun(db).Model(d).Updates(map[string]any{"number": 7})
+			},
+			sql:  "UPDATE `versioned_docs` SET `number`=?,`version`=? WHERE `id` = ? AND `versioned_docs`.`version` = ?",
+			vars: []any{7, int64(4), uint64(1), int64(3)},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, Config{})
+			d := &versionedDoc{ID: 1, Name: "a", Number: 1, Version: 3}
+			seedEntity(t, db, d)
+
+			tx := tt.save(db, d)
+			if tx.Error != nil {
+				t.Fatal(tx.Error)
+			}
+			r := Preview(tx)
+			if r == nil || r.SQL != tt.sql {
+				t.Fatalf("sql = %v; want %q", r, tt.sql)
+			}
+			if !reflect.DeepEqual(r.Vars, tt.vars) {
+				t.Errorf("vars = %#v; want %#v", r.Vars, tt.vars)
+			}
+			if d.Version != 3 {
+				t.Errorf("dry run changed the model version to %d", d.Version)
+			}
+		})
+	}
+}
+
+func TestVersionWithoutSnapshot(t *testing.T) {
+	db, _ := openTestDB(t, Config{})
+	d := &versionedDoc{ID: 1, Name: "a", Version: 3}
+
+	r := Preview(DryRun(db).Save(d))
+	if r == nil || strings.Contains(r.SQL, "WHERE `versioned_docs`.`version`") {
+		t.Fatalf("version guard without a snapshot: %v", r)
+	}
+}
+
+type casDoc struct {
+	ID     uint64 `gorm:"primaryKey"`
+	Name   string
+	Number int64
+	Secret string `gormup:"nocache"`
+}
+
+func TestCompareAndSet(t *testing.T) {
+	cases := []struct {
+		name string
+		save func(db *gorm.DB, d *casDoc) *gorm.DB
+		sql  string
+		vars []any
+	}{
+		{
+			name: "changed columns",
+			save: func(db *gorm.DB, d *casDoc) *gorm.DB {
+				d.Name = "b"
+				d.Number = 2
+				return CompareAndSet(DryRun(db)).Save(d)
+			},
+			sql:  "UPDATE `cas_docs` SET `name`=?,`number`=? WHERE `id` = ? AND `cas_docs`.`name` = ? AND `cas_docs`.`number` = ?",
+			vars: []any{"b", int64(2), uint64(1), "a", int64(1)},
+		},
+		{
+			name: "nocache",
+			save: func(db *gorm.DB, d *casDoc) *gorm.DB {
+				d.Secret = "t"
+				return CompareAndSet(DryRun(db)).Save(d)
+			},
+			sql:  "UPDATE `cas_docs` SET `secret`=? WHERE `id` = ?",
+			vars: []any{"t", uint64(1)},
+		},
+		{
+			name: "expression",
+			save: func(db *gorm.DB, d *casDoc) *gorm.DB {
+				return CompareAndSet(DryRun(db)).Model(d).Update("number", gorm.Expr("number + ?", 1))
+			},
+			sql:  "UPDATE `cas_docs` SET `number`=number + ? WHERE `id` = ?",
+			vars: []any{1, uint64(1)},
+		},
+		{
+			name: "disabled",
+			save: func(db *gorm.DB, d *casDoc) *gorm.DB {
+				d.Name = "b"
+				return DryRun(db).Save(d)
+			},
+			sql:  "UPDATE `cas_docs` SET `name`=? WHERE `id` = ?",
+			vars: []any{"b", uint64(1)},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, Config{})
+			d := &casDoc{ID: 1, Name: "a", Number: 1, Secret: "s"}
+			seedEntity(t, db, d)
+
+			tx := tt.save(db, d)
+			if tx.Error != nil {
+				t.Fatal(tx.Error)
+			}
+			r := Preview(tx)
+			if r == nil || r.SQL != tt.sql {
+				t.Fatalf("sql = %v; want %q", r, tt.sql)
+			}
+			if !reflect.DeepEqual(r.Vars, tt.vars) {
+				t.Errorf("vars = %#v; want %#v", r.Vars, tt.vars)
+			}
+		})
+	}
+}
+
+type testDoc struct {
+	ID     uint64 `gorm:"primaryKey"`
+	Name   string
+	Number int64
+}
+
+var testDocColumns = []string{"id", "name", "number"}
+
+func TestFindSliceFromCache(t *testing.T) {
+	db, fake := openTestDB(t, Config{})
+	fake.rows(testDocColumns, []driver.Value{int64(1), "a", int64(10)}, []driver.Value{int64(2), "b", int64(20)})
+	var loaded []testDoc
+	if err := db.Find(&loaded, "id IN ?", []int{1, 2}).Error; err != nil {
+		t.Fatal(err)
+	}
+	fake.take()
+
+	want := []testDoc{{ID: 1, Name: "a", Number: 10}, {ID: 2, Name: "b", Number: 20}}
+
+	var docs []testDoc
+	if err := db.Find(&docs, "id IN ?", []int{1, 2}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(docs, want) {
+		t.Errorf("[]T = %+v; want %+v", docs, want)
+	}
+
+	var ptrs []*testDoc
+	if err := db.Find(&ptrs, []int{2, 1}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(ptrs) != 2 || ptrs[0] == nil || ptrs[1] == nil || *ptrs[0] != want[1] || *ptrs[1] != want[0] {
+		t.Errorf("[]*T = %+v; want %+v", ptrs, []testDoc{want[1], want[0]})
+	}
+	if q := fake.take(); len(q) != 0 {
+		t.Errorf("queries = %v; want none", q)
+	}
+
+	// копии из кеша не связаны со снимком и друг с другом
+	ptrs[0].Name = "changed"
+	docs = nil
+	db.Find(&docs, "id IN ?", []int{1, 2})
+	if docs[1].Name != "b" {
+		t.Errorf("cached model changed through a returned pointer: %+v", docs[1])
+	}
+}
+
+func TestFindStructFromCacheNeedsOneKey(t *testing.T) {
+	db, fake := openTestDB(t, Config{})
+	fake.rows(testDocColumns, []driver.Value{int64(1), "a", int64(10)}, []driver.Value{int64(2), "b", int64(20)})
+	var loaded []testDoc
+	db.Find(&loaded, "id IN ?", []int{1, 2})
+	fake.take()
+
+	var d testDoc
+	db.Find(&d, "id IN ?", []int{1, 2})
+	if n := fake.count("SELECT"); n != 1 {
+		t.Errorf("select count = %d; want 1", n)
+	}
+
+	d = testDoc{}
+	if err := db.Find(&d, "id = ?", 2).Error; err != nil || d.Name != "b" {
+		t.Errorf("Find(id = 2) = %+v, %v", d, err)
+	}
+	if n := fake.count("SELECT"); n != 0 {
+		t.Errorf("select count = %d; want 0", n)
+	}
+}
+
+type testLink struct {
+	FromID uint64 `gorm:"primaryKey;autoIncrement:false"`
+	ToID   uint64 `gorm:"primaryKey;autoIncrement:false"`
+	Kind   string
+}
+
+type testEvent struct {
+	Name  string
+	Count int64
+}
+
+func TestModelsWithoutSingleKey(t *testing.T) {
+	db, fake := openTestDB(t, Config{Audit: NewAuditTable("audit")})
+
+	run := func(name string, fn func() *gorm.DB) {
+		t.Helper()
+		if err := fn().Error; err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	run("update composite", func() *gorm.DB {
+		return db.Model(&testLink{}).Where("kind = ?", "a").Update("kind", "b")
+	})
+	run("update keyless", func() *gorm.DB {
+		return db.Model(&testEvent{}).Where("name = ?", "a").Update("count", 2)
+	})
+	run("find composite", func() *gorm.DB {
+		var links []testLink
+		return db.Find(&links, "from_id = ?", 1)
+	})
+	run("find keyless", func() *gorm.DB {
+		var events []testEvent
+		return db.Find(&events, "name = ?", "a")
+	})
+	run("delete composite", func() *gorm.DB {
+		return db.Where("from_id = ?", 1).Delete(&testLink{})
+	})
+	run("delete keyless", func() *gorm.DB {
+		return db.Where("name = ?", "a").Delete(&testEvent{})
+	})
+	fake.take()
+}
+
+func TestWriteSelectedAll(t *testing.T) {
+	cases := []struct {
+		name   string
+		update func(db *gorm.DB, d *testDoc) error
+		want   int
+	}{
+		{
+			name:   "explicit star",
+			update: func(db *gorm.DB, d *testDoc) error { return WriteSelected(db).Select("*").Updates(d).Error },
+			want:   1,
+		},
+		{
+			name:   "named columns",
+			update: func(db *gorm.DB, d *testDoc) error { return WriteSelected(db).Select("name").Updates(d).Error },
+			want:   1,
+		},
+		{
+			// "*" от самого Save выбором не считается
+			name:   "save",
+			update: func(db *gorm.DB, d *testDoc) error { return WriteSelected(db).Save(d).Error },
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := openTestDB(t, Config{})
+			d := &testDoc{ID: 1, Name: "a", Number: 1}
+			seedEntity(t, db, d)
+
+			if err := tt.update(db, d); err != nil {
+				t.Fatal(err)
+			}
+			q := fake.take()
+			var updates int
+			for _, v := range q {
+				if strings.HasPrefix(v.SQL, "INSERT") {
+					t.Errorf("unexpected insert: %s", v.SQL)
+				}
+				if strings.HasPrefix(v.SQL, "UPDATE") {
+					updates++
+				}
+			}
+			if updates != tt.want {
+				t.Errorf("updates = %d; want %d (%+v)", updates, tt.want, q)
+			}
+		})
+	}
+}
+
+func TestExpressionAssignments(t *testing.T) {
+	db, fake := openTestDB(t, Config{})
+	d := &testDoc{ID: 1, Name: "a", Number: 1}
+	seedEntity(t, db, d)
+
+	err := db.Model(d).Updates(map[string]any{"name": "a", "number": gorm.Expr("number + ?", 1)}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := fake.take()
+	if len(q) != 1 || q[0].SQL != "UPDATE `test_docs` SET `number`=number + ? WHERE `id` = ?" {
+		t.Fatalf("queries = %v", q)
+	}
+
+	// значение после выражения неизвестно: следующий Save колонку пишет
+	if err := db.Save(d).Error; err != nil {
+		t.Fatal(err)
+	}
+	q = fake.take()
+	if len(q) != 1 || q[0].SQL != "UPDATE `test_docs` SET `number`=? WHERE `id` = ?" {
+		t.Fatalf("queries after expression = %v", q)
+	}
+}
+
+func TestReduceMapUpdates(t *testing.T) {
+	cases := []struct {
+		name   string
+		update func(db *gorm.DB, d *testDoc) *gorm.DB
+		sql    string
+	}{
+		{
+			name: "map no-op",
+			update: func(db *gorm.DB, d *testDoc) *gorm.DB {
+				return db.Model(d).Updates(map[string]any{"name": "a", "number": 1})
+			},
+		},
+		{
+			name: "map partial",
+			update: func(db *gorm.DB, d *testDoc) *gorm.DB {
+				return db.Model(d).Updates(map[string]any{"name": "a", "number": 2})
+			},
+			sql: "UPDATE `test_docs` SET `number`=? WHERE `id` = ?",
+		},
+		{
+			// остальные поля модели отличаются от снимка, но в map их нет
+			name: "model differs outside the map",
+			update: func(db *gorm.DB, d *testDoc) *gorm.DB {
+				d.Name = "local"
+				return db.Model(d).Updates(map[string]any{"number": int8(1)})
+			},
+		},
+		{
+			name: "column no-op",
+			update: func(db *gorm.DB, d *testDoc) *gorm.DB {
+				return db.Model(d).Update("name", "a")
+			},
+		},
+		{
+			name: "column",
+			update: func(db *gorm.DB, d *testDoc) *gorm.DB {
+				return db.Model(d).Update("name", "b")
+			},
+			sql: "UPDATE `test_docs` SET `name`=? WHERE `id` = ?",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := openTestDB(t, Config{})
+			d := &testDoc{ID: 1, Name: "a", Number: 1}
+			seedEntity(t, db, d)
+
+			tx := tt.update(db, d)
+			if tx.Error != nil {
+				t.Fatal(tx.Error)
+			}
+			q := fake.take()
+			if tt.sql == "" {
+				if len(q) != 0 {
+					t.Errorf("queries = %v; want none", q)
+				}
+				if res := Result(tx); res == nil || !res.Skipped {
+					t.Errorf("Result() = %+v; want skipped", res)
+				}
+				return
+			}
+			if len(q) != 1 || q[0].SQL != tt.sql {
+				t.Errorf("queries = %v; want %q", q, tt.sql)
+			}
+		})
+	}
+}
+
+func TestReduceDetachedUpdates(t *testing.T) {
+	cases := []struct {
+		name string
+		id   int
+		dto  testDoc
+		sql  string
+		want testDoc
+	}{
+		{
+			name: "no-op",
+			id:   1,
+			dto:  testDoc{Name: "a", Number: 1},
+			want: testDoc{ID: 1, Name: "a", Number: 1},
+		},
+		{
+			name: "reduced",
+			id:   1,
+			dto:  testDoc{Name: "a", Number: 5},
+			sql:  "UPDATE `test_docs` SET `number`=? WHERE id = ?",
+			want: testDoc{ID: 1, Name: "a", Number: 5},
+		},
+		{
+			name: "no snapshot",
+			id:   2,
+			dto:  testDoc{Name: "a", Number: 5},
+			sql:  "UPDATE `test_docs` SET `name`=?,`number`=? WHERE id = ?",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := openTestDB(t, Config{})
+			seedEntity(t, db, &testDoc{ID: 1, Name: "a", Number: 1})
+
+			if err := db.Model(&testDoc{}).Where("id = ?", tt.id).Updates(tt.dto).Error; err != nil {
+				t.Fatal(err)
+			}
+			q := fake.take()
+			switch {
+			case tt.sql == "" && len(q) != 0:
+				t.Fatalf("queries = %v; want none", q)
+			case tt.sql != "" && (len(q) != 1 || q[0].SQL != tt.sql):
+				t.Fatalf("queries = %v; want %q", q, tt.sql)
+			}
+			if tt.want.ID == 0 {
+				return
+			}
+
+			// снимок в кеше поправлен записанными значениями
+			var got testDoc
+			if err := db.Find(&got, "id = ?", tt.id).Error; err != nil {
+				t.Fatal(err)
+			}
+			if n := fake.count("SELECT"); n != 0 {
+				t.Fatalf("select count = %d; want a cache hit", n)
+			}
+			if got != tt.want {
+				t.Errorf("cached = %+v; want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectOmitColumns(t *testing.T) {
+	db, fake := openTestDB(t, Config{})
+	d := &testDoc{ID: 1, Name: "a", Number: 1}
+	seedEntity(t, db, d)
+
+	// без WriteSelected выбранная, но не изменившаяся колонка не пишется
+	if err := db.Select("name").Save(d).Error; err != nil {
+		t.Fatal(err)
+	}
+	if q := fake.take(); len(q) != 0 {
+		t.Fatalf("queries = %v; want none", q)
+	}
+
+	d.Name, d.Number = "b", 2
+	if err := db.Omit("number").Save(d).Error; err != nil {
+		t.Fatal(err)
+	}
+	if q := fake.take(); len(q) != 1 || q[0].SQL != "UPDATE `test_docs` SET `name`=? WHERE `id` = ?" {
+		t.Fatalf("queries = %v", q)
+	}
+
+	// пропущенная колонка в снимок не попала и пишется следующим Save
+	if err := db.Save(d).Error; err != nil {
+		t.Fatal(err)
+	}
+	if q := fake.take(); len(q) != 1 || q[0].SQL != "UPDATE `test_docs` SET `number`=? WHERE `id` = ?" {
+		t.Fatalf("queries = %v", q)
+	}
+}
+
+func TestLockingQueries(t *testing.T) {
+	cases := []struct {
+		name    string
+		locking clause.Locking
+	}{
+		{name: "for update", locking: clause.Locking{Strength: "UPDATE"}},
+		{name: "for share nowait", locking: clause.Locking{Strength: "SHARE", Options: "NOWAIT"}},
+		{name: "skip locked", locking: clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := openTestDB(t, Config{})
+			seedEntity(t, db, &testDoc{ID: 1, Name: "stale", Number: 1})
+
+			fake.rows(testDocColumns, []driver.Value{int64(1), "fresh", int64(2)})
+			err := db.Transaction(func(tx *gorm.DB) error {
+				var d testDoc
+				if err := tx.Clauses(tt.locking).Find(&d, "id = ?", 1).Error; err != nil {
+					return err
+				}
+				if n := fake.count("SELECT"); n != 1 {
+					t.Errorf("select count = %d; want the row read from the database", n)
+				}
+				if d.Name != "fresh" {
+					t.Errorf("name = %q; want the locked row", d.Name)
+				}
+				if !Locked(tx, &d) {
+					t.Error("Locked() = false inside the locking transaction")
+				}
+				if Locked(db, &d) {
+					t.Error("Locked() = true outside the locking transaction")
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// снимок обновлен из заблокированной строки
+			var cached testDoc
+			if err := db.Find(&cached, "id = ?", 1).Error; err != nil {
+				t.Fatal(err)
+			}
+			if n := fake.count("SELECT"); n != 0 || cached.Name != "fresh" {
+				t.Errorf("select count = %d, cached = %+v; want the refreshed row from cache", n, cached)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package gormup
+
+import (
+	"slices"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Verdict int
+
+const (
+	// VerdictCache — клауза не мешает: выборку по ключам можно отдать из кеша
+	VerdictCache Verdict = iota
+	// VerdictRefresh — запрос идет в БД, но строки целые: результат обновляет кеш
+	VerdictRefresh
+	// VerdictBypass — строки неполные или агрегированные: кеш не участвует
+	VerdictBypass
+)
+
+func (v Verdict) String() string {
+	switch v {
+	case VerdictCache:
+		return "cache"
+	case VerdictRefresh:
+		return "refresh"
+	default:
+		return "bypass"
+	}
+}
+
+// Policy решает, как запрос работает с кешем. keys — сколько значений ключа
+// нашлось в условии; 0 — запрос не выборка по ключу, и отдать из кеша нечего.
+type Policy interface {
+	Verdict(stmt *gorm.Statement, keys int) Verdict
+}
+
+type PolicyFunc func(stmt *gorm.Statement, keys int) Verdict
+
+func (f PolicyFunc) Verdict(stmt *gorm.Statement, keys int) Verdict {
+	return f(stmt, keys)
+}
+
+// DefaultPolicy разбирает запрос по клаузам:
+//
+//	SELECT    список колонок без * или Omit — bypass; DISTINCT — refresh
+//	raw SQL   bypass
+//	JOINS     refresh: inner join может отсеять строку, которая есть в кеше
+//	WHERE     cache: ключи извлекает сам плагин
+//	GROUP BY  bypass (вместе с HAVING): строки могут быть агрегатами
+//	ORDER BY  cache для одного ключа, иначе refresh: кеш не сортирует
+//	LIMIT     refresh при OFFSET или лимите меньше числа ключей, иначе cache
+//	FOR       refresh: блокировку берет только БД
+//	Preload   refresh: из кеша ассоциации не подгружаются
+//	прочие    refresh
+type DefaultPolicy struct{}
+
+func (d DefaultPolicy) Verdict(stmt *gorm.Statement, keys int) Verdict {
+	verdict := VerdictCache
+	for _, v := range d.Explain(stmt, keys) {
+		verdict = max(verdict, v)
+	}
+	return verdict
+}
+
+// Explain возвращает решение по каждой клаузе запроса.
+func (d DefaultPolicy) Explain(stmt *gorm.Statement, keys int) map[string]Verdict {
+	out := map[string]Verdict{
+		"SELECT": d.selectVerdict(stmt),
+	}
+	if stmt.SQL.Len() > 0 {
+		out["RAW"] = VerdictBypass
+	}
+	if len(stmt.Joins) > 0 {
+		out["JOINS"] = VerdictRefresh
+	}
+	if len(stmt.Preloads) > 0 {
+		out["PRELOAD"] = VerdictRefresh
+	}
+
+	for name, c := range stmt.Clauses {
+		switch name {
+		case "SELECT", "WHERE":
+		case "FROM":
+			if from, ok := c.Expression.(clause.From); ok && len(from.Joins) > 0 {
+				out["JOINS"] = VerdictRefresh
+			}
+		case "GROUP BY":
+			out[name] = VerdictBypass
+		case "ORDER BY":
+			if keys > 1 {
+				out[name] = VerdictRefresh
+			}
+		case "LIMIT":
+			if limit, ok := c.Expression.(clause.Limit); ok {
+				if limit.Offset > 0 || (limit.Limit != nil && *limit.Limit < keys) {
+					out[name] = VerdictRefresh
+				}
+			}
+		default:
+			out[name] = VerdictRefresh
+		}
+	}
+	return out
+}
+
+func (d DefaultPolicy) selectVerdict(stmt *gorm.Statement) Verdict {
+	if len(stmt.Omits) > 0 {
+		return VerdictBypass
+	}
+	if len(stmt.Selects) > 0 && !slices.Contains(stmt.Selects, "*") {
+		return VerdictBypass
+	}
+	if stmt.Distinct {
+		return VerdictRefresh
+	}
+	return VerdictCache
+}
@@ -0,0 +1,125 @@
+package gormup
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestDefaultPolicy(t *testing.T) {
+	cases := []struct {
+		name  string
+		query func(db *gorm.DB, d *[]testDoc) *gorm.DB
+		want  Verdict
+	}{
+		{
+			name:  "key lookup",
+			query: func(db *gorm.DB, d *[]testDoc) *gorm.DB { return db.Find(d, "id = ?", 1) },
+			want:  VerdictCache,
+		},
+		{
+			name:  "order by one key",
+			query: func(db *gorm.DB, d *[]testDoc) *gorm.DB { return db.Order("name").Find(d, "id = ?", 1) },
+			want:  VerdictCache,
+		},
+		{
+			name:  "order by several keys",
+			query: func(db *gorm.DB, d *[]testDoc) *gorm.DB { return db.Order("name").Find(d, "id IN ?", []int{1, 2}) },
+			want:  VerdictRefresh,
+		},
+		{
+			name:  "limit below keys",
+			query: func(db *gorm.DB, d *[]testDoc) *gorm.DB { return db.Limit(1).Find(d, "id IN ?", []int{1, 2}) },
+			want:  VerdictRefresh,
+		},
+		{
+			name:  "offset",
+			query: func(db *gorm.DB, d *[]testDoc) *gorm.DB { return db.Offset(1).Find(d, "id = ?", 1) },
+			want:  VerdictRefresh,
+		},
+		{
+			name: "joins",
+			query: func(db *gorm.DB, d *[]testDoc) *gorm.DB {
+				return db.Joins("JOIN owners ON owners.doc_id = test_docs.id").Find(d, "test_docs.id = ?", 1)
+			},
+			want: VerdictRefresh,
+		},
+		{
+			name:  "distinct",
+			query: func(db *gorm.DB, d *[]testDoc) *gorm.DB { return db.Distinct().Find(d, "id = ?", 1) },
+			want:  VerdictRefresh,
+		},
+		{
+			name: "group by",
+			query: func(db *gorm.DB, d *[]testDoc) *gorm.DB {
+				return db.Group("id").Having("count(*) > 0").Find(d, "id = ?", 1)
+			},
+			want: VerdictBypass,
+		},
+		{
+			name:  "partial select",
+			query: func(db *gorm.DB, d *[]testDoc) *gorm.DB { return db.Select("id", "name").Find(d, "id = ?", 1) },
+			want:  VerdictBypass,
+		},
+		{
+			name:  "omit",
+			query: func(db *gorm.DB, d *[]testDoc) *gorm.DB { return db.Omit("number").Find(d, "id = ?", 1) },
+			want:  VerdictBypass,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := openTestDB(t, Config{})
+			seedEntity(t, db, &testDoc{ID: 1, Name: "stale", Number: 1})
+			seedEntity(t, db, &testDoc{ID: 2, Name: "stale", Number: 1})
+
+			fake.rows(testDocColumns, []driver.Value{int64(1), "fresh", int64(2)})
+			var docs []testDoc
+			if err := tt.query(db, &docs).Error; err != nil {
+				t.Fatal(err)
+			}
+			selects := fake.count("SELECT")
+
+			var cached testDoc
+			if err := db.Find(&cached, "id = ?", 1).Error; err != nil {
+				t.Fatal(err)
+			}
+			if n := fake.count("SELECT"); n != 0 {
+				t.Fatalf("select count = %d; want the entity kept in cache", n)
+			}
+
+			var got Verdict
+			switch {
+			case selects == 0:
+				got = VerdictCache
+			case cached.Name == "fresh":
+				got = VerdictRefresh
+			default:
+				got = VerdictBypass
+			}
+			if got != tt.want {
+				t.Errorf("verdict = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCustomPolicy(t *testing.T) {
+	// политика ужесточает умолчание: test_docs из кеша не читаем
+	db, fake := openTestDB(t, Config{Policy: PolicyFunc(func(stmt *gorm.Statement, keys int) Verdict {
+		if stmt.Table == "test_docs" {
+			return VerdictBypass
+		}
+		return DefaultPolicy{}.Verdict(stmt, keys)
+	})})
+	seedEntity(t, db, &testDoc{ID: 1, Name: "a", Number: 1})
+
+	var d testDoc
+	if err := db.Find(&d, "id = ?", 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n := fake.count("SELECT"); n != 1 {
+		t.Errorf("select count = %d; want the policy to bypass the cache", n)
+	}
+}
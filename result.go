@@ -0,0 +1,58 @@
+package gormup
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SaveResult struct {
+	// Skipped — запрос не отправлялся: после редукции писать нечего
+	Skipped bool
+	// Written — колонки, попавшие в SET
+	Written []string
+	// Unchanged — колонки, отброшенные как совпадающие со снимком
+	Unchanged []string
+	// CacheUpdated — снимок обновлен записанными значениями, а не вытеснен
+	CacheUpdated bool
+}
+
+// Result возвращает итог последнего обновления, прошедшего через редукцию;
+// nil, если редукция к запросу не применялась, в том числе когда
+// для модели не нашлось снимка.
+//
+// Пропущенное обновление по-прежнему оставляет RowsAffected = -1: при нуле
+// db.Save посчитает, что строки нет, и уйдет в INSERT. Пропуск проверяйте
+// через Skipped, а не по RowsAffected.
+func Result(db *gorm.DB) *SaveResult {
+	v, ok := db.Get(resultKey)
+	if !ok {
+		return nil
+	}
+	res, _ := v.(*SaveResult)
+	return res
+}
+
+func (p *plugin) getResult(db *gorm.DB) *SaveResult {
+	return Result(db)
+}
+
+func (p *plugin) setResult(db *gorm.DB, original, reduced clause.Set) {
+	if p.getEntity(db) == nil {
+		// снимка нет: set ушел как есть, редукции не было
+		return
+	}
+	res := &SaveResult{Skipped: len(reduced) == 0}
+
+	written := make(map[string]bool, len(reduced))
+	for _, a := range reduced {
+		written[a.Column.Name] = true
+		res.Written = append(res.Written, a.Column.Name)
+	}
+	for _, a := range original {
+		if !written[a.Column.Name] {
+			res.Unchanged = append(res.Unchanged, a.Column.Name)
+		}
+	}
+
+	db.Set(resultKey, res)
+}
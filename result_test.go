@@ -0,0 +1,70 @@
+package gormup
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestResult(t *testing.T) {
+	db, fake := openTestDB(t, Config{})
+	d := &testDoc{ID: 1, Name: "a", Number: 1}
+	seedEntity(t, db, d)
+
+	d.Name = "b"
+	tx := db.Save(d)
+	if tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	want := &SaveResult{Written: []string{"name"}, Unchanged: []string{"number"}, CacheUpdated: true}
+	if got := Result(tx); !reflect.DeepEqual(got, want) {
+		t.Errorf("Result() = %+v; want %+v", got, want)
+	}
+	fake.take()
+
+	tx = db.Save(d)
+	if tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	if got := Result(tx); got == nil || !got.Skipped || len(got.Written) != 0 {
+		t.Errorf("Result() = %+v; want skipped", got)
+	}
+	// -1, а не 0: иначе Save ушел бы в INSERT
+	if tx.RowsAffected != -1 {
+		t.Errorf("RowsAffected = %d; want -1", tx.RowsAffected)
+	}
+	if q := fake.take(); len(q) != 0 {
+		t.Errorf("queries = %v; want none", q)
+	}
+
+	if got := Result(db.Model(&testDoc{}).Where("number = ?", 1).Update("name", "x")); got != nil {
+		t.Errorf("Result() without snapshot = %+v; want nil", got)
+	}
+}
+
+func TestStrict(t *testing.T) {
+	cases := []struct {
+		name string
+		cfg  Config
+		db   func(db *gorm.DB) *gorm.DB
+	}{
+		{name: "scope", db: Strict},
+		{name: "config", cfg: Config{Strict: true}, db: func(db *gorm.DB) *gorm.DB { return db }},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := openTestDB(t, tt.cfg)
+			d := &testDoc{ID: 1, Name: "a", Number: 1}
+			seedEntity(t, db, d)
+
+			if err := tt.db(db).Save(d).Error; !errors.Is(err, ErrNotChanged) {
+				t.Errorf("Save() = %v; want ErrNotChanged", err)
+			}
+			if q := fake.take(); len(q) != 0 {
+				t.Errorf("queries = %v; want none", q)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package gormup
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type UnitOfWork struct {
+	sync.Mutex
+
+	db       *gorm.DB
+	entities map[string]*entity
+}
+
+func NewUnitOfWork(db *gorm.DB) *UnitOfWork {
+	return &UnitOfWork{
+		db:       db,
+		entities: map[string]*entity{},
+	}
+}
+
+func (u *UnitOfWork) Scope(db *gorm.DB) *gorm.DB {
+	return db.Set(unitOfWorkKey, u)
+}
+
+func (u *UnitOfWork) Dirty(ctx context.Context) (out []any) {
+	for _, ent := range u.dirtyEntities(ctx) {
+		out = append(out, ent.Model())
+	}
+	return out
+}
+
+func (u *UnitOfWork) Flush(ctx context.Context) error {
+	dirty := u.dirtyEntities(ctx)
+	if len(dirty) == 0 {
+		return nil
+	}
+
+	return u.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, ent := range dirty {
+			db := tx
+			if ent.table.name != ent.schema.Table {
+				// строка прочитана из Table("...") или шарда: пишем туда же
+				db = tx.Table(ent.table.name)
+			}
+			err := db.Omit(clause.Associations).Save(ent.Model()).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (u *UnitOfWork) track(ent *entity) {
+	if ent == nil {
+		return
+	}
+
+	u.Lock()
+	defer u.Unlock()
+
+	u.entities[ent.GetKey()] = ent
+}
+
+func (u *UnitOfWork) dirtyEntities(ctx context.Context) (out []*entity) {
+	u.Lock()
+	defer u.Unlock()
+
+	for _, ent := range u.entities {
+		if len(ent.ChangedColumns(ctx)) > 0 {
+			out = append(out, ent)
+		}
+	}
+
+	// стабильный порядок записи, чтобы параллельные flush не ловили deadlock
+	slices.SortFunc(out, func(a, b *entity) int {
+		if c := strings.Compare(a.table.key(), b.table.key()); c != 0 {
+			return c
+		}
+		return strings.Compare(a.id, b.id)
+	})
+
+	return out
+}
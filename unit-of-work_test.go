@@ -0,0 +1,86 @@
+package gormup
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"testing"
+)
+
+func TestUnitOfWorkTracksCacheHits(t *testing.T) {
+	db, fake := openTestDB(t, Config{})
+	ctx := db.Statement.Context
+	fake.rows(testDocColumns, []driver.Value{int64(1), "a", int64(10)})
+	var loaded testDoc
+	db.Find(&loaded, "id = ?", 1)
+	fake.take()
+
+	uow := NewUnitOfWork(db)
+	var d testDoc
+	if err := db.Scopes(uow.Scope).Find(&d, "id = ?", 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n := fake.count("SELECT"); n != 0 {
+		t.Fatalf("select count = %d; want a cache hit", n)
+	}
+
+	d.Name = "changed"
+	if dirty := uow.Dirty(ctx); len(dirty) != 1 || dirty[0] != &d {
+		t.Fatalf("Dirty() = %v; want the caller's model", dirty)
+	}
+	if err := uow.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	q := fake.take()
+	if len(q) != 1 || q[0].SQL != "UPDATE `test_docs` SET `name`=? WHERE `id` = ?" {
+		t.Fatalf("queries = %v", q)
+	}
+	if dirty := uow.Dirty(ctx); len(dirty) != 0 {
+		t.Errorf("Dirty() after Flush = %v", dirty)
+	}
+}
+
+func TestUnitOfWorkFlush(t *testing.T) {
+	db, fake := openTestDB(t, Config{})
+	ctx := db.Statement.Context
+
+	uow := NewUnitOfWork(db)
+	fake.rows(testDocColumns,
+		[]driver.Value{int64(2), "b", int64(20)},
+		[]driver.Value{int64(1), "a", int64(10)},
+		[]driver.Value{int64(3), "c", int64(30)},
+	)
+	var docs []*testDoc
+	if err := db.Scopes(uow.Scope).Find(&docs).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 3 {
+		t.Fatalf("docs = %v", docs)
+	}
+	fake.take()
+
+	if dirty := uow.Dirty(ctx); len(dirty) != 0 {
+		t.Fatalf("Dirty() before changes = %v", dirty)
+	}
+	docs[0].Number = 21
+	docs[1].Name = "aa"
+
+	if err := uow.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	q := fake.take()
+	want := []fakeQuery{
+		{SQL: "UPDATE `test_docs` SET `name`=? WHERE `id` = ?", Args: []driver.Value{"aa", int64(1)}},
+		{SQL: "UPDATE `test_docs` SET `number`=? WHERE `id` = ?", Args: []driver.Value{int64(21), int64(2)}},
+	}
+	if !reflect.DeepEqual(q, want) {
+		t.Fatalf("queries = %v; want %v", q, want)
+	}
+
+	// второй Flush ничего не пишет: снимки обновлены
+	if err := uow.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := fake.count("UPDATE"); n != 0 {
+		t.Errorf("updates after second Flush = %d; want 0", n)
+	}
+}
@@ -1,14 +1,18 @@
 package gormup
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
 	"database/sql/driver"
 	"encoding/json"
 	"reflect"
+	"time"
 
 	"github.com/shockerli/cvt"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
 )
 
 func isSupportForUpdate(v any) bool {
@@ -21,6 +25,13 @@ func isSupportForUpdate(v any) bool {
 		gorm.Valuer,
 		*gorm.DB:
 		return false
+	case []any:
+		// подзапросы в map-обновлениях gorm оборачивает в срез
+		for _, el := range v.([]any) {
+			if !isSupportForUpdate(el) {
+				return false
+			}
+		}
 	}
 	return true
 }
@@ -53,6 +64,120 @@ func toString(v any) string {
 	return ""
 }
 
+func toColumnValue(v any) any {
+	if dv, ok := v.(driver.Valuer); ok {
+		rfv := reflect.ValueOf(dv)
+		if rfv.Kind() == reflect.Ptr && rfv.IsNil() {
+			return nil
+		}
+		if xv, err := dv.Value(); err == nil {
+			return xv
+		}
+	}
+
+	rfv := reflect.ValueOf(v)
+	for rfv.Kind() == reflect.Ptr {
+		if rfv.IsNil() {
+			return nil
+		}
+		rfv = rfv.Elem()
+	}
+	if !rfv.IsValid() {
+		return nil
+	}
+	return rfv.Interface()
+}
+
+// serializeValue приводит значение поля к тому виду, в котором его пишет serializer.
+func serializeValue(ctx context.Context, f *schema.Field, dst reflect.Value, v any) any {
+	if f.Serializer == nil {
+		return v
+	}
+	if _, ok := v.(driver.Valuer); ok {
+		return v
+	}
+
+	var valuer schema.SerializerValuerInterface = f.Serializer
+	if sv, ok := v.(schema.SerializerValuerInterface); ok {
+		valuer = sv
+	}
+	if out, err := valuer.Value(ctx, f, dst, v); err == nil {
+		return out
+	}
+	return v
+}
+
+// normalizeValue приводит значение из map-обновления к типу поля модели,
+// чтобы сравнение со снимком не зависело от типа литерала (int против int64).
+func normalizeValue(ctx context.Context, f *schema.Field, dst reflect.Value, v any) any {
+	if f.Serializer != nil {
+		return serializeValue(ctx, f, dst, v)
+	}
+	if v == nil || reflect.TypeOf(v) == f.FieldType || f.Schema == nil {
+		return v
+	}
+
+	tmp := reflect.New(f.Schema.ModelType)
+	if err := f.Set(ctx, tmp, v); err != nil {
+		return v
+	}
+	value, _ := f.ValueOf(ctx, tmp)
+	return value
+}
+
+func toSnapshotValue(v any) any {
+	v = toColumnValue(v)
+
+	// изменяемые значения копируем, чтобы правки модели не меняли снимок
+	switch rfv := reflect.ValueOf(v); rfv.Kind() {
+	case reflect.Slice:
+		if rfv.IsNil() {
+			return v
+		}
+		cp := reflect.MakeSlice(rfv.Type(), rfv.Len(), rfv.Len())
+		reflect.Copy(cp, rfv)
+		return cp.Interface()
+	case reflect.Map:
+		if rfv.IsNil() {
+			return v
+		}
+		cp := reflect.MakeMapWithSize(rfv.Type(), rfv.Len())
+		iter := rfv.MapRange()
+		for iter.Next() {
+			cp.SetMapIndex(iter.Key(), iter.Value())
+		}
+		return cp.Interface()
+	}
+	return v
+}
+
+func isEqualValue(a, b any) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	switch av := a.(type) {
+	case []byte:
+		bv, ok := b.([]byte)
+		return ok && (av == nil) == (bv == nil) && bytes.Equal(av, bv)
+	case time.Time:
+		bv, ok := b.(time.Time)
+		return ok && av.Equal(bv)
+	}
+
+	if reflect.TypeOf(a) != reflect.TypeOf(b) {
+		return toString(a) == toString(b)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func canSet(v reflect.Value) bool {
+	if v.Kind() == reflect.Ptr {
+		return !v.IsNil()
+	}
+	return v.CanAddr()
+}
+
 func getModelType(v reflect.Value) reflect.Type {
 	t := v.Type()
 	for {
@@ -96,6 +221,19 @@ func is2PointerOfStruct(v reflect.Type) bool {
 	return v.Kind() == reflect.Ptr && isPointerOfStruct(v.Elem())
 }
 
+// isCacheableDest проверяет, что в dest можно разложить n моделей из кеша:
+// в одну структуру — только одну, в срез — любое число.
+func isCacheableDest(dest reflect.Type, n int) bool {
+	if isPointerOfStruct(dest) || is2PointerOfStruct(dest) {
+		return n == 1
+	}
+	if dest.Kind() != reflect.Ptr || dest.Elem().Kind() != reflect.Slice {
+		return false
+	}
+	el := dest.Elem().Elem()
+	return isStruct(el) || isPointerOfStruct(el)
+}
+
 func setValue(target reflect.Value, values ...reflect.Value) {
 	if target.Kind() == reflect.Interface {
 		target = target.Elem()
@@ -108,8 +246,8 @@ func setValue(target reflect.Value, values ...reflect.Value) {
 	if isPointerOfArray(target.Type()) {
 		newVal := reflect.MakeSlice(target.Elem().Type(), len(values), len(values))
 		for i, v := range values {
-			el := newVal.Index(i).Interface()
-			setValue(reflect.ValueOf(&el), v)
+			// элемент адресуем в самом срезе: копия через interface до вызывающего не дойдет
+			setValue(newVal.Index(i).Addr(), v)
 		}
 		target.Elem().Set(newVal)
 	} else {
@@ -119,10 +257,10 @@ func setValue(target reflect.Value, values ...reflect.Value) {
 		}
 
 		if is2PointerOfStruct(target.Type()) {
-			if isPointerOfStruct(value.Type()) {
-				target.Elem().Set(value)
-			} else if isStruct(value.Type()) {
-				p := reflect.New(target.Type().Elem())
+			value = reflect.Indirect(value)
+			if isStruct(value.Type()) {
+				// отдаем копию: модель из стора не должна меняться через результат
+				p := reflect.New(value.Type())
 				p.Elem().Set(value)
 				target.Elem().Set(p)
 			}
@@ -138,3 +276,37 @@ func setValue(target reflect.Value, values ...reflect.Value) {
 		}
 	}
 }
+
+// assignValue присваивает src в dst, разыменовывая и приводя типы, где это возможно.
+func assignValue(dst, src reflect.Value) bool {
+	for src.IsValid() && (src.Kind() == reflect.Ptr || src.Kind() == reflect.Interface) &&
+		!src.Type().AssignableTo(dst.Type()) {
+		if src.IsNil() {
+			src = reflect.Value{}
+			break
+		}
+		src = src.Elem()
+	}
+
+	if !src.IsValid() {
+		dst.SetZero()
+		return true
+	}
+	if src.Type().AssignableTo(dst.Type()) {
+		dst.Set(src)
+		return true
+	}
+	if dst.Kind() == reflect.Ptr {
+		p := reflect.New(dst.Type().Elem())
+		if !assignValue(p.Elem(), src) {
+			return false
+		}
+		dst.Set(p)
+		return true
+	}
+	if src.Type().ConvertibleTo(dst.Type()) {
+		dst.Set(src.Convert(dst.Type()))
+		return true
+	}
+	return false
+}